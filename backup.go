@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 备份索引中的一条记录。索引文件位于hosts旁（如 /etc/hosts.backup.index），
+// 每行一个JSON对象，按时间从旧到新排列：
+//
+//	{"time":"2026-10-15T09:16:18Z","file":"/etc/hosts.backup.20261015T091618.000Z","note":"新增 github.com"}
+//
+// file是备份时hosts的完整内容，note概括了那次写入做了哪些修改
+type backupEntry struct {
+	Time time.Time `json:"time"`
+	File string    `json:"file"`
+	Note string    `json:"note,omitempty"`
+}
+
+func backupIndexPath(hostsPath string) string { return hostsPath + ".backup.index" }
+
+// 读取备份索引，文件不存在时返回空列表
+func readBackupIndex(hostsPath string) ([]backupEntry, error) {
+	file, err := os.Open(backupIndexPath(hostsPath))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []backupEntry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var e backupEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			// 跳过损坏的行，其余备份仍然可用
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// 写入备份索引。先写临时文件再重命名，避免中断时丢失索引
+func writeBackupIndex(hostsPath string, entries []backupEntry) error {
+	var b strings.Builder
+	for _, e := range entries {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		b.Write(data)
+		b.WriteByte('\n')
+	}
+	tmp := backupIndexPath(hostsPath) + ".tmp"
+	if err := os.WriteFile(tmp, []byte(b.String()), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, backupIndexPath(hostsPath))
+}
+
+// 修改hosts前备份当前内容并记入索引，只保留最近 -backups 份。note概括本次的修改
+func backupHosts(hostsPath, note string) error {
+	if *backupCount <= 0 {
+		return nil
+	}
+	data, err := os.ReadFile(hostsPath)
+	if err != nil {
+		return err
+	}
+	entries, err := readBackupIndex(hostsPath)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	e := backupEntry{
+		Time: now,
+		File: hostsPath + ".backup." + now.Format("20060102T150405.000Z"),
+		Note: note,
+	}
+	if err := os.WriteFile(e.File, data, 0o644); err != nil {
+		return err
+	}
+	entries = append(entries, e)
+
+	for len(entries) > *backupCount {
+		if err := os.Remove(entries[0].File); err != nil && !os.IsNotExist(err) {
+			fmt.Fprintf(out, "⚠️ 删除旧备份 %s 失败: %v\n", entries[0].File, err)
+		}
+		entries = entries[1:]
+	}
+	return writeBackupIndex(hostsPath, entries)
+}
+
+// 概括一次写入的修改，如 "新增 a.com; 更新 b.com, c.com; 删除 d.com"。
+// 条目都没有变化时是合并区块或去掉区块外冲突条目等整理
+func changeNote(actions map[string]string) string {
+	byAction := make(map[string][]string)
+	for domain, action := range actions {
+		byAction[action] = append(byAction[action], domain)
+	}
+	var parts []string
+	for _, a := range []struct{ action, label string }{{actionAdded, "新增"}, {actionUpdated, "更新"}, {actionRemoved, "删除"}} {
+		if domains := byAction[a.action]; len(domains) > 0 {
+			slices.Sort(domains)
+			parts = append(parts, a.label+" "+strings.Join(domains, ", "))
+		}
+	}
+	if len(parts) == 0 {
+		return "整理hosts"
+	}
+	return strings.Join(parts, "; ")
+}
+
+// 按 -restore 的值选择备份：数字n表示倒数第n份（1为最新），
+// 否则视为时间前缀（如 2026-10-15T09），选择匹配的最新一份
+func selectBackup(entries []backupEntry, sel string) (backupEntry, error) {
+	if len(entries) == 0 {
+		return backupEntry{}, fmt.Errorf("没有可用的备份")
+	}
+	if n, err := strconv.Atoi(sel); err == nil {
+		if n < 1 || n > len(entries) {
+			return backupEntry{}, fmt.Errorf("备份序号 %d 超出范围 (1-%d)", n, len(entries))
+		}
+		return entries[len(entries)-n], nil
+	}
+	for _, e := range slices.Backward(entries) {
+		if strings.HasPrefix(e.Time.Format(time.RFC3339), sel) {
+			return e, nil
+		}
+	}
+	return backupEntry{}, fmt.Errorf("没有时间匹配 %s 的备份", sel)
+}
+
+// 列出备份，序号与 -restore 使用的相同
+func printBackups(entries []backupEntry) {
+	for i, e := range slices.Backward(entries) {
+		fmt.Fprintf(out, "%2d: %s  修改前 (%s)\n", len(entries)-i, e.Time.Local().Format(time.DateTime), e.Note)
+	}
+}
+
+// 用选中的备份覆盖hosts
+func restoreHosts(sel string) error {
+	hostsPath, err := hostsFilePath()
+	if err != nil {
+		return err
+	}
+	entries, err := readBackupIndex(hostsPath)
+	if err != nil {
+		return err
+	}
+	e, err := selectBackup(entries, sel)
+	if err != nil {
+		if len(entries) > 0 {
+			fmt.Fprintln(out, "可用的备份：")
+			printBackups(entries)
+		}
+		return err
+	}
+
+	data, err := os.ReadFile(e.File)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(hostsPath, data, 0o644); err != nil {
+		return immutableHint(hostsPath, err)
+	}
+	fmt.Fprintf(out, "♻️ 已恢复到 %s 修改前的hosts (该次修改: %s)\n", e.Time.Local().Format(time.DateTime), e.Note)
+	return nil
+}
+
+// fastip backups：列出可用的hosts备份及其大小，序号与 -restore 使用的相同。
+// -diff 时附带与当前hosts相比增减的行数。只读，不修改任何文件
+func backupsCmd(args []string) error {
+	fs := flag.NewFlagSet("backups", flag.ExitOnError)
+	diff := fs.Bool("diff", false, "显示每份备份与当前hosts相比增减的行数")
+	fs.StringVar(container, "container", "", "列出指定Docker容器的hosts备份")
+	fs.Parse(args)
+
+	hostsPath, err := hostsFilePath()
+	if err != nil {
+		return err
+	}
+	entries, err := readBackupIndex(hostsPath)
+	if err != nil {
+		return err
+	}
+	var current []string
+	if *diff {
+		if current, err = readHostsLines(hostsPath); err != nil {
+			return err
+		}
+	}
+
+	if len(entries) == 0 {
+		fmt.Printf("%s 没有备份\n", hostsPath)
+	} else {
+		fmt.Printf("%s 的备份（%d 份，-restore <序号> 恢复）：\n", hostsPath, len(entries))
+		fmt.Printf("%4s  %-19s %10s  %s\n", "序号", "时间", "大小", "修改说明")
+		for i, e := range slices.Backward(entries) {
+			size := "缺失"
+			if info, err := os.Stat(e.File); err == nil {
+				size = formatSize(info.Size())
+			}
+			note := e.Note
+			if *diff {
+				if lines, err := readHostsLines(e.File); err == nil {
+					added, removed := diffLines(lines, current)
+					note += fmt.Sprintf("  [当前 +%d -%d 行]", added, removed)
+				}
+			}
+			fmt.Printf("%4d  %-19s %10s  %s\n", len(entries)-i, e.Time.Local().Format(time.DateTime), size, note)
+		}
+	}
+
+	// 索引损坏或被手动修改后，目录中可能还有索引之外的备份文件
+	files, _ := filepath.Glob(hostsPath + ".backup.*")
+	for _, f := range files {
+		if f == backupIndexPath(hostsPath) || strings.HasSuffix(f, ".tmp") ||
+			slices.ContainsFunc(entries, func(e backupEntry) bool { return e.File == f }) {
+			continue
+		}
+		fmt.Printf("⚠️ 未记入索引的备份: %s\n", f)
+	}
+	return nil
+}
+
+// 从a变为b新增和删除的行数，忽略行的顺序
+func diffLines(a, b []string) (added, removed int) {
+	count := make(map[string]int)
+	for _, line := range a {
+		count[line]++
+	}
+	for _, line := range b {
+		if count[line] > 0 {
+			count[line]--
+		} else {
+			added++
+		}
+	}
+	for _, n := range count {
+		removed += n
+	}
+	return added, removed
+}
+
+// 以合适的单位显示文件大小
+func formatSize(n int64) string {
+	if n < 1024 {
+		return fmt.Sprintf("%dB", n)
+	}
+	return fmt.Sprintf("%.1fKB", float64(n)/1024)
+}
@@ -0,0 +1,23 @@
+package main
+
+import "testing"
+
+func TestChangeNote(t *testing.T) {
+	tests := []struct {
+		actions map[string]string
+		want    string
+	}{
+		{map[string]string{"b.com": actionAdded, "a.com": actionAdded}, "新增 a.com, b.com"},
+		{
+			map[string]string{"a.com": actionAdded, "b.com": actionUpdated, "c.com": actionRemoved, "d.com": actionUnchanged},
+			"新增 a.com; 更新 b.com; 删除 c.com",
+		},
+		{map[string]string{"a.com": actionRemoved}, "删除 a.com"},
+		{map[string]string{"a.com": actionUnchanged, "b.com": actionManual}, "整理hosts"},
+	}
+	for _, tt := range tests {
+		if got := changeNote(tt.actions); got != tt.want {
+			t.Errorf("changeNote(%v) = %q, want %q", tt.actions, got, tt.want)
+		}
+	}
+}
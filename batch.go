@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// 读取域名列表文件，忽略空行和注释
+func loadDomains(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return readDomains(file)
+}
+
+// 从标准输入读取域名列表，-watch 时多轮运行共用第一次读取的结果
+var stdinDomains = sync.OnceValues(func() ([]string, error) {
+	return readDomains(stdin)
+})
+
+// 逐行读取域名，忽略空行和注释
+func readDomains(r io.Reader) ([]string, error) {
+	var domains []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		domains = append(domains, line)
+	}
+	return domains, scanner.Err()
+}
+
+// -skip-regex 编译后的正则，未指定时为nil
+var skipPattern *regexp.Regexp
+
+// 去掉匹配 -skip-regex 的域名
+func skipMatching(domains []string) []string {
+	if skipPattern == nil {
+		return domains
+	}
+	// 不能原地修改：-stdin 的域名列表在 -watch 的多轮运行间共用
+	var kept []string
+	for _, domain := range domains {
+		if skipPattern.MatchString(domain) {
+			verbosef("⏭️ 跳过匹配 -skip-regex 的域名: %s\n", domain)
+			continue
+		}
+		kept = append(kept, domain)
+	}
+	if n := len(domains) - len(kept); n > 0 {
+		fmt.Fprintf(out, "⏭️ 跳过 %d 个匹配 -skip-regex 的域名\n", n)
+	}
+	return kept
+}
+
+// 状态文件写入器，每条结果写一行JSON并立即落盘
+type stateWriter struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// 打开状态文件。resume为true时保留已有记录并返回已成功完成的域名及其结果，
+// 否则清空文件重新开始
+func openState(path string, resume bool) (*stateWriter, map[string]Result, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, nil, err
+	}
+
+	done := make(map[string]Result)
+	if !resume {
+		file, err := os.Create(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		return &stateWriter{file: file}, done, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, nil, err
+	}
+
+	// 上次中断时最后一行可能只写了一半，截掉它以保证文件仍是合法的JSONL
+	valid := len(data)
+	if i := bytes.LastIndexByte(data, '\n'); i+1 != len(data) {
+		valid = i + 1
+	}
+	for line := range bytes.SplitSeq(data[:valid], []byte("\n")) {
+		var r Result
+		if json.Unmarshal(line, &r) == nil && r.Error == "" {
+			done[r.Domain] = r
+		}
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := file.Truncate(int64(valid)); err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	if _, err := file.Seek(0, io.SeekEnd); err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	return &stateWriter{file: file}, done, nil
+}
+
+// 追加一条结果
+func (s *stateWriter) Write(r Result) error {
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return s.file.Sync()
+}
+
+// 关闭状态文件
+func (s *stateWriter) Close() error {
+	return s.file.Close()
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// 单个数据来源对单个域名的测试结果
+type benchResult struct {
+	Result
+	Elapsed time.Duration
+}
+
+// bench 子命令：用各数据来源探测同一批域名，比较选出的IP和耗时，不修改hosts
+func benchCmd(args []string) error {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	providers := fs.String("providers", "itdog,local", "要比较的数据来源，逗号分隔: itdog|local|mock")
+	fs.StringVar(domainFlag, "domain", *domainFlag, "要测试的域名")
+	fs.StringVar(batchFile, "batch", "", "从文件读取域名列表，每行一个")
+	fs.DurationVar(timeout, "timeout", *timeout, "单个域名的探测超时")
+	fs.StringVar(dnsServers, "dns-servers", *dnsServers, "local数据来源使用的DNS服务器")
+	fs.StringVar(latencyUnit, "latency-unit", *latencyUnit, "输出延迟的单位: ms|s")
+	fs.Parse(args)
+	if err := validateLatencyUnit(); err != nil {
+		return err
+	}
+
+	domains := []string{*domainFlag}
+	if *batchFile != "" {
+		var err error
+		domains, err = loadDomains(*batchFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	var names []string
+	results := make(map[string][]benchResult)
+	for name := range strings.SplitSeq(*providers, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		ctx, provider, cancel, err := openProvider(name)
+		if err != nil {
+			// 如没有安装Chrome时itdog不可用，跳过即可
+			fmt.Fprintf(out, "⚠️ 跳过数据来源 %s: %v\n", name, err)
+			continue
+		}
+		names = append(names, name)
+		for _, domain := range domains {
+			fmt.Fprintf(out, "⏱️ %s: %s\n", name, domain)
+			start := time.Now()
+			r := probeDomain(ctx, provider, domain)
+			results[name] = append(results[name], benchResult{r, time.Since(start)})
+		}
+		cancel()
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("没有可用的数据来源")
+	}
+
+	fmt.Fprintf(out, "\n%-30s %-8s %-39s %12s %10s\n", "域名", "来源", "IP", "延迟", "耗时")
+	for i, domain := range domains {
+		for _, name := range names {
+			r := results[name][i]
+			ip, latency := r.IP, formatLatency(r.Latency)
+			if r.Error != "" {
+				ip, latency = "❌ "+r.Error, "-"
+			}
+			fmt.Fprintf(out, "%-30s %-8s %-39s %12s %10s\n", domain, name, ip, latency, r.Elapsed.Round(time.Millisecond))
+		}
+	}
+
+	fmt.Fprintln(out, "\n汇总：")
+	for _, name := range names {
+		var total time.Duration
+		ok := 0
+		for _, r := range results[name] {
+			total += r.Elapsed
+			if r.Error == "" {
+				ok++
+			}
+		}
+		fmt.Fprintf(out, "%-8s 成功 %d/%d  总耗时 %s  平均 %s\n", name, ok, len(domains),
+			total.Round(time.Millisecond), (total / time.Duration(len(domains))).Round(time.Millisecond))
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"slices"
+	"time"
+)
+
+// 每次测量TTFB的次数，取中位数以减小偶然的波动
+const benchmarkSamples = 3
+
+// -benchmark：先用系统解析测量每个域名的HTTPS首字节时间，再只在本进程内把域名指向
+// 选出的IP（不修改hosts）重新测量，输出前后对比。结束后没有需要清理的状态
+func runBenchmark(ctx context.Context, provider LatencyProvider) error {
+	domains, err := collectDomains(ctx)
+	if err != nil {
+		return err
+	}
+
+	type row struct {
+		domain, ip    string
+		before, after time.Duration
+		beforeErr     error
+		afterErr      error
+	}
+	var rows []row
+	for _, domain := range domains {
+		fmt.Fprintf(out, "⏱️ %s\n", domain)
+		r := row{domain: domain}
+		r.before, r.beforeErr = medianTTFB(ctx, domain, "")
+		res := probeDomain(ctx, provider, domain)
+		if res.Error != "" {
+			r.afterErr = fmt.Errorf("%s", res.Error)
+		} else {
+			r.ip = res.IP
+			r.after, r.afterErr = medianTTFB(ctx, domain, res.IP)
+		}
+		rows = append(rows, r)
+	}
+
+	fmt.Fprintf(out, "\n%-30s %-39s %10s %10s %8s\n", "域名", "IP", "之前", "之后", "提升")
+	for _, r := range rows {
+		before, after, gain := "失败", "失败", "-"
+		if r.beforeErr == nil {
+			before = r.before.Round(time.Millisecond).String()
+		}
+		if r.afterErr == nil {
+			after = r.after.Round(time.Millisecond).String()
+		}
+		if r.beforeErr == nil && r.afterErr == nil {
+			gain = fmt.Sprintf("%.1f%%", float64(r.before-r.after)/float64(r.before)*100)
+		}
+		fmt.Fprintf(out, "%-30s %-39s %10s %10s %8s\n", r.domain, r.ip, before, after, gain)
+		for _, err := range []error{r.beforeErr, r.afterErr} {
+			if err != nil {
+				verbosef("  %s: %v\n", r.domain, err)
+			}
+		}
+	}
+	return nil
+}
+
+// 多次测量TTFB取中位数，任一次失败即返回错误
+func medianTTFB(ctx context.Context, domain, ip string) (time.Duration, error) {
+	times := make([]time.Duration, 0, benchmarkSamples)
+	for range benchmarkSamples {
+		d, err := measureTTFB(ctx, domain, ip)
+		if err != nil {
+			return 0, err
+		}
+		times = append(times, d)
+	}
+	slices.Sort(times)
+	return times[len(times)/2], nil
+}
+
+// 测量一次 https://domain/ 的首字节时间，包括建立连接和TLS握手。
+// ip不为空时只在本次请求中把域名解析为该IP，SNI和证书校验仍使用域名
+func measureTTFB(ctx context.Context, domain, ip string) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, settingsFor(domain).Timeout)
+	defer cancel()
+
+	dialer := probeDialer()
+	tr := &http.Transport{
+		DisableKeepAlives: true,
+		TLSClientConfig:   &tls.Config{ServerName: domain},
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			if ip != "" {
+				_, port, err := net.SplitHostPort(addr)
+				if err != nil {
+					return nil, err
+				}
+				addr = net.JoinHostPort(ip, port)
+			}
+			return dialer.DialContext(ctx, network, addr)
+		},
+	}
+	defer tr.CloseIdleConnections()
+
+	var first time.Time
+	trace := &httptrace.ClientTrace{GotFirstResponseByte: func() { first = time.Now() }}
+	req, err := http.NewRequestWithContext(httptrace.WithClientTrace(ctx, trace), http.MethodGet, "https://"+domain+"/", nil)
+	if err != nil {
+		return 0, err
+	}
+	start := time.Now()
+	resp, err := tr.RoundTrip(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return first.Sub(start), nil
+}
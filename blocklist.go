@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+var ErrBlocklistedIP = errors.New("在 -blocklist 中")
+
+// -blocklist 中的网段，单个IP按 /32 或 /128 处理
+var blocklist []*net.IPNet
+
+// 读取IP黑名单，每行一个IP或CIDR网段，忽略空行和注释。
+// 用于排除在本地已知不可用（如被封锁）的IP，即使它们延迟最低也不会被选中
+func loadBlocklist(path string) error {
+	lines, err := loadDomains(path)
+	if err != nil {
+		return err
+	}
+	for i, line := range lines {
+		// 允许行尾注释
+		line, _, _ = strings.Cut(line, "#")
+		line = strings.TrimSpace(line)
+		if !strings.Contains(line, "/") {
+			if ip := net.ParseIP(line); ip != nil && ip.To4() != nil {
+				line += "/32"
+			} else {
+				line += "/128"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(line)
+		if err != nil {
+			return fmt.Errorf("%s 第 %d 项: 无效的IP或网段 %q", path, i+1, lines[i])
+		}
+		blocklist = append(blocklist, ipNet)
+	}
+	return nil
+}
+
+// IP是否在黑名单中
+func blocklisted(ip net.IP) bool {
+	for _, n := range blocklist {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// 缓存中单个域名最近一次成功的结果
+type cacheEntry struct {
+	IP       string     `json:"ip"`
+	Latency  float64    `json:"latency_ms"`
+	Time     time.Time  `json:"time"`
+	ChosenAt time.Time  `json:"chosen_at,omitzero"` // 首次选择该IP的时间，IP不变时保持不变
+	Top      []cachedIP `json:"top,omitempty"`      // -top 大于1时写入hosts的全部IP，离线运行时同样写入这些IP
+}
+
+// 缓存的一个IP及其平均延迟
+type cachedIP struct {
+	IP      string  `json:"ip"`
+	Latency float64 `json:"latency_ms"`
+}
+
+// 缓存的键。最快的IP与所在网络有关，默认在域名后附加网络指纹，
+// 切换网络后不会用到其他网络下的结果；-cache-fingerprint=false 时只用域名
+func cacheKey(domain string) string {
+	if !*cacheFingerprint {
+		return domain
+	}
+	return domain + "@" + networkFingerprint()
+}
+
+// 读取缓存，文件不存在时返回空缓存
+func loadCache(path string) (map[string]cacheEntry, error) {
+	cache := make(map[string]cacheEntry)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cache, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &cache); err != nil {
+		return nil, fmt.Errorf("解析缓存 %s 失败: %w", path, err)
+	}
+	return cache, nil
+}
+
+// 把本次成功的结果合并进缓存。先写临时文件再重命名，避免中断时损坏缓存
+func updateCache(path string, results []Result) error {
+	cache, err := loadCache(path)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	for _, r := range results {
+		if r.Error == "" {
+			key := cacheKey(r.Domain)
+			chosenAt := now
+			if prev, ok := cache[key]; ok && prev.IP == r.IP && !prev.ChosenAt.IsZero() {
+				chosenAt = prev.ChosenAt
+			}
+			cache[key] = cacheEntry{IP: r.IP, Latency: r.Latency, Time: now, ChosenAt: chosenAt, Top: cachedTop(r)}
+		}
+	}
+
+	data, err := json.MarshalIndent(cache, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// 结果中写入hosts的多个IP及各自的平均延迟，只有一个IP时不需要另外记录
+func cachedTop(r Result) []cachedIP {
+	if len(r.Top) < 2 {
+		return nil
+	}
+	top := make([]cachedIP, 0, len(r.Top))
+	for _, ip := range r.Top {
+		latency := r.Latency
+		if i := slices.IndexFunc(r.Candidates, func(s IPStat) bool { return s.IP == ip }); i >= 0 {
+			latency = r.Candidates[i].Avg
+		}
+		top = append(top, cachedIP{IP: ip, Latency: latency})
+	}
+	return top
+}
+
+// 离线模式的数据来源，把缓存中的IP当作节点的结果返回
+type cacheProvider struct {
+	cache map[string]cacheEntry
+}
+
+func newCacheProvider(path string) (*cacheProvider, error) {
+	cache, err := loadCache(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(cache) == 0 {
+		return nil, fmt.Errorf("缓存 %s 不存在或为空，无法离线运行", path)
+	}
+	return &cacheProvider{cache: cache}, nil
+}
+
+func (p *cacheProvider) Probe(ctx context.Context, domain string) ([]string, []PingResult, error) {
+	e, ok := p.cache[cacheKey(domain)]
+	if !ok {
+		if *cacheFingerprint {
+			return nil, nil, fmt.Errorf("缓存中没有当前网络下域名 %s 的结果", domain)
+		}
+		return nil, nil, fmt.Errorf("缓存中没有域名 %s", domain)
+	}
+
+	age := time.Since(e.Time)
+	fmt.Fprintf(out, "📦 使用缓存 %s (%s前)\n", domain, formatAge(age))
+	if *cacheMaxAge > 0 && age > *cacheMaxAge {
+		fmt.Fprintf(out, "⚠️ %s 的缓存已超过 %s，IP可能已经不是最快的\n", domain, formatAge(*cacheMaxAge))
+	}
+	if len(e.Top) == 0 {
+		return []string{e.IP}, []PingResult{{Node: cacheNode, IP: e.IP, Time: e.Latency}}, nil
+	}
+	ips := make([]string, 0, len(e.Top))
+	pings := make([]PingResult, 0, len(e.Top))
+	for _, c := range e.Top {
+		ips = append(ips, c.IP)
+		pings = append(pings, PingResult{Node: cacheNode, IP: c.IP, Time: c.Latency})
+	}
+	return ips, pings, nil
+}
+
+// 缓存结果使用的节点名。缓存的IP在探测时已经按地区和运营商选过，节点过滤不适用于它
+const cacheNode = "缓存"
+
+// 以最大的单位粗略显示时长，如 45s、20m、2h、3d
+func formatAge(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%dd", int(d.Hours()/24))
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// -top 大于1时缓存全部IP，-offline 时写入与在线运行相同的IP
+func TestCacheKeepsTop(t *testing.T) {
+	setFlag(t, &out, io.Discard)
+	setFlag(t, cacheFingerprint, false)
+	setFlag(t, topN, 2)
+	path := filepath.Join(t.TempDir(), "cache.json")
+	results := []Result{
+		{
+			Domain: "a.com", IP: "1.1.1.1", Latency: 10, Top: []string{"1.1.1.1", "2.2.2.2"},
+			Candidates: []IPStat{{IP: "1.1.1.1", Avg: 10}, {IP: "2.2.2.2", Avg: 20}, {IP: "3.3.3.3", Avg: 30}},
+		},
+		{Domain: "b.com", IP: "4.4.4.4", Latency: 15},
+		{Domain: "c.com", Error: "失败"},
+	}
+	if err := updateCache(path, results); err != nil {
+		t.Fatal(err)
+	}
+	provider, err := newCacheProvider(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		domain  string
+		wantTop []string
+		wantIP  string
+	}{
+		{"a.com", []string{"1.1.1.1", "2.2.2.2"}, "1.1.1.1"},
+		{"b.com", []string{"4.4.4.4"}, "4.4.4.4"},
+	}
+	for _, tt := range tests {
+		r := probeDomain(context.Background(), provider, tt.domain)
+		if r.Error != "" {
+			t.Fatalf("%s: %s", tt.domain, r.Error)
+		}
+		if r.IP != tt.wantIP || !slices.Equal(r.Top, tt.wantTop) {
+			t.Errorf("%s: IP = %s Top = %v, want %s %v", tt.domain, r.IP, r.Top, tt.wantIP, tt.wantTop)
+		}
+	}
+	if _, _, err := provider.Probe(context.Background(), "c.com"); err == nil {
+		t.Error("失败的结果不应写入缓存")
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// 解析每个域名的CNAME，把最终指向的主机名追加到域名列表。
+// 只固定域名本身时，解析仍可能沿CNAME走到CDN主机名，所以把它也一并固定
+func appendCNAMETargets(ctx context.Context, domains []string) []string {
+	resolver := newResolver(*dnsServers)
+	result := slices.Clone(domains)
+	for _, domain := range domains {
+		lookupCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		cname, err := resolver.LookupCNAME(lookupCtx, domain)
+		cancel()
+		if err != nil {
+			fmt.Fprintf(out, "⚠️ 解析 %s 的CNAME失败: %v\n", domain, err)
+			continue
+		}
+
+		target := strings.TrimSuffix(cname, ".")
+		if strings.EqualFold(target, domain) {
+			continue
+		}
+		fmt.Fprintf(out, "🔗 %s -> %s\n", domain, target)
+		if !slices.Contains(result, target) {
+			result = append(result, target)
+		}
+	}
+	return result
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+)
+
+var errResultsDiffer = errors.New("探测结果与比较文件不一致")
+
+// 读取hosts片段中的 域名->IP 映射
+func loadHostsFragment(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return parseHosts(file)
+}
+
+// 比较本次探测得到的条目与文件中的条目，打印新增、删除和变化
+func compareResults(path string, results []Result) error {
+	want, err := loadHostsFragment(path)
+	if err != nil {
+		return err
+	}
+
+	got := make(map[string]string)
+	for _, r := range results {
+		if r.Error == "" {
+			got[r.Domain] = r.IP
+		}
+	}
+
+	diffs := 0
+	for _, domain := range slices.Sorted(maps.Keys(got)) {
+		old, ok := want[domain]
+		switch {
+		case !ok:
+			fmt.Fprintf(out, "+ %s %s\n", got[domain], domain)
+			diffs++
+		case old != got[domain]:
+			fmt.Fprintf(out, "~ %s: %s -> %s\n", domain, old, got[domain])
+			diffs++
+		}
+	}
+	for _, domain := range slices.Sorted(maps.Keys(want)) {
+		if _, ok := got[domain]; !ok {
+			fmt.Fprintf(out, "- %s %s\n", want[domain], domain)
+			diffs++
+		}
+	}
+
+	if diffs > 0 {
+		fmt.Fprintf(out, "❌ 共 %d 处差异\n", diffs)
+		return errResultsDiffer
+	}
+	fmt.Fprintln(out, "✅ 探测结果与比较文件一致")
+	return nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"flag"
+	"time"
+)
+
+// 命令行参数
+var (
+	domainFlag          = flag.String("domain", "github.com", "要测试的域名")
+	batchFile           = flag.String("batch", "", "批量模式：域名列表文件，每行一个域名，#开头为注释")
+	stateFile           = flag.String("state", "results/state.jsonl", "批量模式下逐条写入结果的JSONL状态文件")
+	resume              = flag.Bool("resume", false, "批量模式下跳过状态文件中已成功完成的域名")
+	concurrency         = flag.Int("concurrency", 1, "同时探测的域名数量")
+	jsonOut             = flag.Bool("json", false, "以JSON数组输出全部结果（按输入顺序）")
+	format              = flag.String("format", "text", "输出格式: text|json（同 -json）|switchhosts（输出SwitchHosts导入JSON，隐含 -dry-run）")
+	jsonPretty          = flag.Bool("json-pretty", false, "以缩进格式输出JSON（隐含 -json）")
+	latencyUnit         = flag.String("latency-unit", "ms", "输出延迟的单位: ms|s")
+	dryRun              = flag.Bool("dry-run", false, "只输出结果，不修改hosts文件")
+	flushEvery          = flag.Int("flush-every", 0, "每完成N个域名就写入一次hosts，0表示全部完成后再写入")
+	watch               = flag.Duration("watch", 0, "监视模式：每隔指定时间重新运行一次，0表示只运行一次")
+	jitter              = flag.Duration("jitter", 0, "监视模式下每次间隔额外增加 [0, jitter) 的随机等待，实际间隔为 watch+随机抖动")
+	jitterStartup       = flag.Bool("jitter-startup", false, "监视模式下首次运行前也随机等待 [0, jitter)")
+	interactive         = flag.Bool("interactive", false, "逐个域名列出候选IP，手动确认或选择要使用的IP")
+	network             = flag.String("network", "auto", "本机网络类型: auto(自动检测)|dual|ipv6-only，用于强制指定检测结果")
+	showStats           = flag.Bool("stats", false, "运行结束后输出所有域名的延迟统计和更新情况")
+	compareTo           = flag.String("compare-to", "", "与指定的hosts片段文件比较探测结果，不修改hosts，存在差异时以非零状态退出")
+	retryInitial        = flag.Duration("retry-initial", 2*time.Second, "查询itdog失败后首次重试前的等待时间")
+	retryMultiplier     = flag.Float64("retry-multiplier", 2, "每次重试后等待时间的倍数")
+	retryMaxDelay       = flag.Duration("retry-max-delay", 15*time.Second, "单次重试等待时间的上限")
+	retryJitter         = flag.Float64("retry-jitter", 0.2, "重试等待时间的随机浮动比例，0.2表示±20%")
+	retryMaxElapsed     = flag.Duration("retry-max-elapsed", 45*time.Second, "包括重试在内的最长总耗时，0表示不重试；-timeout 始终是硬上限")
+	sectionName         = flag.String("section-name", "fastip", "hosts中管理区块的名称，标记为 # <name>-begin / # <name>-end，多个配置共存时用于区分")
+	sampleK             = flag.Int("sample-nodes", 0, "每次运行随机抽取K个有效节点参与评分，0表示使用全部节点")
+	seed                = flag.Int64("seed", 0, "随机种子，非0时抽样结果可复现")
+	providerName        = flag.String("provider", "itdog", "延迟数据来源: itdog|local（本机解析并测量TCP连接延迟）|mock（返回固定的模拟数据，仅用于测试和演示）")
+	mockFile            = flag.String("mock-file", "", "mock数据来源使用的JSON文件，格式为 {\"域名\": [{\"node\":...,\"ip\":...,\"time\":...}]}，留空使用内置数据")
+	cacheFile           = flag.String("cache", "results/cache.json", "保存每个域名最近一次成功结果的缓存文件")
+	offline             = flag.Bool("offline", false, "离线模式：不访问网络，直接用缓存中的IP写入hosts")
+	strict              = flag.Bool("strict", false, "同一IP被多个不相关的域名共用时视为错误，不写入hosts（使用 -flush-every 时之前的批次已经写入）")
+	dnsServers          = flag.String("dns-servers", "", "local数据来源解析域名使用的DNS服务器，逗号分隔，如 8.8.8.8,1.1.1.1，留空使用系统解析")
+	historyFile         = flag.String("history", "results/history.jsonl", "追加记录每次运行结果的历史文件，留空不记录；可用 fastip history 查看")
+	topN                = flag.Int("top", 1, "每个域名写入hosts的IP数量，按延迟从低到高排列")
+	preferRegion        = flag.String("prefer-region", "", "写入多个IP时，归属地包含该地区的IP排在前面，例如 北京")
+	verify              = flag.Bool("verify", false, "写入前检查IP的443端口能否连接，无法连接的IP换成下一个可连接的候选IP，全部无法连接时跳过该域名")
+	configFile          = flag.String("config", "", "配置文件：.yaml/.yml/.toml 为结构化配置（支持按域名设置），其他扩展名按每行一个域名读取")
+	timeout             = flag.Duration("timeout", 60*time.Second, "单个域名查询的超时，包括重试在内")
+	regions             = flag.String("regions", "", "只使用节点名称包含这些地区的检测结果，逗号分隔，如 北京,上海")
+	retryOnEmptyRegions = flag.Bool("retry-on-empty-regions", false, "-regions 过滤掉全部节点时改用全部节点，而不是报错")
+	followCNAME         = flag.Bool("follow-cname", false, "解析域名的CNAME，把最终指向的CDN主机名也加入探测和写入")
+	sharedIPDomains     = flag.String("shared-ip-domains", "", "共用同一个IP的域名组，组内逗号分隔，多组用分号分隔，如 github.com,assets-cdn.github.com")
+	logFile             = flag.String("log-file", "", "把运行信息同时追加写入该文件")
+	reportFile          = flag.String("report-file", "", "把本次运行的结果写入该文件，扩展名为 .csv 时写CSV，否则写JSON")
+	nodeRegionMapFile   = flag.String("node-region-map", "", "节点名称到地区和运营商的映射JSON文件，合并在内置映射之上，格式为 {\"节点名称片段\": {\"region\": \"北京\", \"isp\": \"电信\"}}")
+	verbose             = flag.Bool("verbose", false, "输出详细的调试信息")
+	stableComments      = flag.Bool("stable-comments", false, "hosts中不写入生成时间等每次都会变化的注释，便于用git跟踪hosts文件")
+	scoreFormula        = flag.String("score-formula", "latency=1", "候选IP的综合评分权重，如 latency=0.5,jitter=0.3,loss=0.2，得分越低越好")
+	overrideManual      = flag.Bool("override-manual", false, "区块外已有手动条目的域名也自动更新（默认跳过这些域名）")
+	cacheMaxAge         = flag.Duration("cache-max-age", 24*time.Hour, "使用缓存时，超过该时长的条目会给出警告，0表示不检查")
+	quiet               = flag.Bool("quiet", false, "安静模式，不显示批量探测的进度")
+	flushCmd            = flag.String("flush-cmd", "", "自定义刷新DNS缓存的命令（参数以空格分隔），指定后不再使用内置的刷新方式")
+	probeCount          = flag.Int("probe-count", 1, "每个域名探测的次数，多次的节点结果合并后再选择IP")
+	elevate             = flag.Bool("elevate", false, "没有写入hosts的权限时不再询问，直接以管理员权限(sudo/UAC)重新运行")
+	cacheFingerprint    = flag.Bool("cache-fingerprint", true, "缓存按网络指纹（本机子网的哈希）区分，切换网络后不使用其他网络的缓存")
+	echo                = flag.Bool("echo", false, "写入hosts后在标准输出打印写入的管理区块，-json 时放在JSON结果的hosts_block中")
+	verifyBeforeFlush   = flag.Bool("validate-ip-reachability-before-flush", false, "刷新DNS前检查写入的IP，全部无法连接时不刷新")
+	showVersion         = flag.Bool("version", false, "显示版本和构建信息，可配合 -format json 使用")
+	stdinList           = flag.Bool("stdin", false, "从标准输入读取域名列表，每行一个，忽略空行和#开头的注释")
+	backupCount         = flag.Int("backups", 3, "修改hosts前备份，最多保留的份数，0表示不备份")
+	restore             = flag.String("restore", "", "从备份恢复hosts: 序号(1为最新)或时间前缀(如 2026-10-15T09)")
+	probeTimeout        = flag.Duration("probe-timeout", 3*time.Second, "本机连接候选IP（local数据来源和 -verify 检查）的单次超时，-timeout 则是整个域名查询的上限")
+	testType            = flag.String("test-type", "ping", "itdog的测试类型: ping|http，http按首包时间(TTFB)选择，不可用时退回ping")
+	estimate            = flag.Bool("estimate", false, "在本机比较当前解析的IP和选出的IP，估算延迟提升，提升不足 -min-improvement 的域名不修改")
+	minImprovement      = flag.Float64("min-improvement", 10, "-estimate 时修改hosts所需的最小延迟提升(ms)")
+	lockFile            = flag.String("lock-file", "results/fastip.pid", "实例锁文件，防止多个实例同时运行")
+	force               = flag.Bool("force", false, "忽略实例锁，即使已有实例在运行也继续")
+	quietJSON           = flag.Bool("quiet-json", false, "严格JSON模式：标准输出只有最终的JSON，错误也以JSON报告，其余信息全部不输出")
+	onNoCandidate       = flag.String("on-no-candidate", "skip", "域名没有合适的IP时的处理: skip 跳过该域名，只报告失败；keep 同样不修改，结果中标记为保留原有条目(kept)；remove 从管理区块中删除该域名的条目。查询本身失败（如网络错误）时总是跳过，避免 -watch 中的临时故障删掉可用的条目")
+	container           = flag.String("container", "", "写入指定Docker容器（ID或名称）的hosts，而不是本机的hosts")
+	onNetworkChange     = flag.Bool("on-network-change", false, "-watch 时检测到网络变化（切换网络、网卡启停）立即重新探测")
+	templateText        = flag.String("template", "", "按Go text/template输出每个结果，代替默认的输出，可用字段: .Domain .IP .IPs .Top .AvgMs .Latency .Action .Error")
+	stickyWindow        = flag.Duration("sticky-window", 0, "上次选择的IP在该时长内继续使用，除非新的IP快 -sticky-margin 以上，0表示不启用")
+	stickyMargin        = flag.Float64("sticky-margin", 10, "-sticky-window 内切换IP所需的最小延迟优势(ms)")
+	connectivity        = flag.Bool("connectivity", false, "只在本机检查hosts中已写入的IP能否连接（超时见 -probe-timeout），全部可连接时退出码为0，否则为1")
+	runsInterval        = flag.Duration("runs-interval", 2*time.Second, "-probe-count/-runs 多次探测之间的间隔")
+	dualWrite           = flag.Bool("dual-write", false, "同时写入最快的IPv4和IPv6地址；某一地址族没有候选时，之前写入的该地址族条目会被删除")
+	dashboard           = flag.Bool("dashboard", false, "在终端中以原地刷新的状态表显示每个域名的探测进度和结果")
+	strictValidation    = flag.Bool("strict-validation", false, "汇总前去掉数据异常的节点（IP为空或无效、响应时间为负数或超过10秒）并报告数量")
+	writeIfFaster       = flag.Bool("write-if-faster", false, "在本机比较hosts中当前的IP和选出的IP，只有选出的IP更快时才写入")
+	printIP             = flag.Bool("print-ip", false, "只探测 -domain 并在标准输出打印最快的IP，不修改hosts，供脚本使用")
+	maxCandidates       = flag.Int("max-candidates", 20, "每个域名只保留平均响应时间最低的N个IP参与评分和验证，0表示不限制")
+	flushCooldown       = flag.Duration("flush-cooldown", time.Minute, "监视模式下两次刷新DNS缓存的最小间隔，冷却期内的刷新推迟到之后的轮次")
+	mergeStrategy       = flag.String("merge-strategy", "replace-all", "区块外同一域名有多行条目时的处理方式（配合 -override-manual）: replace-all 全部更新、first-wins 只更新第一行、last-wins 只更新最后一行，其余行去掉该域名")
+	skipRegex           = flag.String("skip-regex", "", "跳过匹配该正则表达式的域名，在探测前过滤")
+	probeKeepAlive      = flag.Bool("probe-keepalive", true, "本机探测的连接是否开启TCP keep-alive（间隔15秒）")
+	benchmark           = flag.Bool("benchmark", false, "对比测量：先用系统解析、再只在本进程内使用选出的IP测量HTTPS首字节时间，输出前后对比，不修改hosts")
+	recordRaw           = flag.String("record-raw", "", "把itdog返回的各节点数据保存到该目录下的 <域名>.json，格式与 -mock-file 相同，用于排查和重放")
+	showTiming          = flag.Bool("timing", false, "运行结束后输出各阶段（读取域名、数据来源查询、本机验证、写入hosts、刷新DNS）的耗时，JSON输出中附带 timing 字段")
+	replayDir           = flag.String("replay", "", "不访问itdog，改为读取该目录下 -record-raw 记录的 <域名>.json，用于离线演示、排查和测试")
+	blockPosition       = flag.String("block-position", "bottom", "hosts中还没有管理区块时新区块的位置: top|bottom，已有的区块保持原位")
+	notify              = flag.Bool("notify", false, "hosts中的条目有变化时发送桌面通知（Linux用notify-send，macOS用osascript，Windows用toast），不可用时静默跳过")
+	requireAll          = flag.Bool("require-all-domains", false, "全部域名都得到有效IP时才写入hosts，否则不做任何修改并以非零状态退出。默认尽力而为，成功的域名照常写入")
+	dials               = flag.Int("dials", 1, "local数据来源对每个候选IP连接的次数，大于1时优先选择连接成功率高的IP，其次比较延迟")
+	probePorts          = flag.String("probe-ports", "443", "-verify 等可达性检查要求可以连接的端口，逗号分隔，如 80,443，任一端口无法连接即视为不可用")
+	hostsOnly           = flag.String("output-hosts-only", "", "只生成独立的hosts片段（带区块标记的管理条目）写入该文件，- 表示标准输出，不读取也不修改系统hosts")
+	blocklistFile       = flag.String("blocklist", "", "IP黑名单文件，每行一个IP或CIDR网段，其中的IP即使延迟最低也不会被选中")
+	failFast            = flag.Bool("fail-fast", false, "任一域名失败时取消其余探测并以非零状态退出，已在进行中的并发探测会被中断")
+)
+
+func init() {
+	// -state-file 是 -state 的别名，与 -log-file、-report-file 命名一致
+	flag.StringVar(stateFile, "state-file", *stateFile, "同 -state")
+	flag.StringVar(nodeRegionMapFile, "region-map", *nodeRegionMapFile, "同 -node-region-map")
+	flag.IntVar(probeCount, "runs", *probeCount, "同 -probe-count")
+	flag.DurationVar(probeTimeout, "dial-timeout", *probeTimeout, "同 -probe-timeout")
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// 结构化配置文件，按扩展名识别YAML或TOML。defaults中的设置覆盖命令行参数，
+// domains中每个域名的设置再覆盖defaults，未填写的项沿用上一级的值。
+//
+// YAML示例：
+//
+//	defaults:
+//	  timeout: 30s
+//	  top: 1
+//	domains:
+//	  - name: github.com
+//	    top: 2
+//	    prefer_region: 北京
+//	  - name: raw.githubusercontent.com
+//	    isp: 电信
+//
+// TOML示例：
+//
+//	[defaults]
+//	timeout = "30s"
+//
+//	[[domains]]
+//	name = "github.com"
+//	top = 2
+type fileConfig struct {
+	Defaults domainConfig   `yaml:"defaults" toml:"defaults"`
+	Domains  []domainConfig `yaml:"domains" toml:"domains"`
+}
+
+// 配置文件中的一组设置
+type domainConfig struct {
+	Name         string `yaml:"name" toml:"name"`
+	Timeout      string `yaml:"timeout" toml:"timeout"`             // 查询超时，如 30s
+	Top          int    `yaml:"top" toml:"top"`                     // 写入hosts的IP数量
+	PreferRegion string `yaml:"prefer_region" toml:"prefer_region"` // 优先的IP归属地
+	ISP          string `yaml:"isp" toml:"isp"`                     // 只使用该运营商的节点
+}
+
+// 单个域名生效的设置
+type domainSettings struct {
+	Timeout      time.Duration
+	Top          int
+	PreferRegion string
+	ISP          string
+}
+
+// 配置文件中的默认设置和按域名的设置
+var (
+	configDefaults  domainConfig
+	domainOverrides = make(map[string]domainConfig)
+)
+
+// 读取配置文件并返回其中的域名列表
+func loadConfig(path string) ([]string, error) {
+	var cfg fileConfig
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := yaml.Unmarshal(data, &cfg); err != nil {
+			return nil, fmt.Errorf("解析配置 %s 失败: %w", path, err)
+		}
+	case ".toml":
+		if _, err := toml.DecodeFile(path, &cfg); err != nil {
+			return nil, fmt.Errorf("解析配置 %s 失败: %w", path, err)
+		}
+	default:
+		// 兼容每行一个域名的纯文本格式
+		return loadDomains(path)
+	}
+
+	if err := checkDomainConfig(cfg.Defaults); err != nil {
+		return nil, fmt.Errorf("配置 %s 的 defaults: %w", path, err)
+	}
+	configDefaults = cfg.Defaults
+
+	var domains []string
+	for _, d := range cfg.Domains {
+		if d.Name == "" {
+			return nil, fmt.Errorf("配置 %s 中有未填写 name 的域名", path)
+		}
+		if err := checkDomainConfig(d); err != nil {
+			return nil, fmt.Errorf("配置 %s 的 %s: %w", path, d.Name, err)
+		}
+		domainOverrides[d.Name] = d
+		domains = append(domains, d.Name)
+	}
+	return domains, nil
+}
+
+// 检查一组设置是否合法
+func checkDomainConfig(c domainConfig) error {
+	if c.Timeout != "" {
+		if d, err := time.ParseDuration(c.Timeout); err != nil || d <= 0 {
+			return fmt.Errorf("无效的 timeout: %q", c.Timeout)
+		}
+	}
+	if c.Top < 0 {
+		return fmt.Errorf("无效的 top: %d", c.Top)
+	}
+	return nil
+}
+
+// 按 命令行参数 < 配置defaults < 域名设置 的优先级得到域名生效的设置
+func settingsFor(domain string) domainSettings {
+	s := domainSettings{
+		Timeout:      *timeout,
+		Top:          *topN,
+		PreferRegion: *preferRegion,
+	}
+	for _, c := range []domainConfig{configDefaults, domainOverrides[domain]} {
+		if c.Timeout != "" {
+			s.Timeout, _ = time.ParseDuration(c.Timeout)
+		}
+		if c.Top > 0 {
+			s.Top = c.Top
+		}
+		if c.PreferRegion != "" {
+			s.PreferRegion = c.PreferRegion
+		}
+		if c.ISP != "" {
+			s.ISP = c.ISP
+		}
+	}
+	return s
+}
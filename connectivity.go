@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+)
+
+var errConnectivity = errors.New("部分hosts条目的IP无法连接")
+
+// 只在本机检查管理区块中各条目的IP能否连接，不查询itdog也不修改hosts。
+// 连接超时由 -probe-timeout 指定，有任一IP无法连接时返回错误
+func checkConnectivity(ctx context.Context) error {
+	path, err := hostsFilePath()
+	if err != nil {
+		return err
+	}
+	lines, err := readHostsLines(path)
+	if err != nil {
+		return err
+	}
+
+	type entry struct {
+		ip, domain string
+		ping       PingResult
+	}
+	var entries []*entry
+	block := blockEntries(managedBlock(lines))
+	for _, domain := range slices.Sorted(maps.Keys(block)) {
+		for _, ip := range block[domain] {
+			entries = append(entries, &entry{ip: ip, domain: domain})
+		}
+	}
+	if len(entries) == 0 {
+		return fmt.Errorf("%s 中没有%s区块的条目", path, *sectionName)
+	}
+
+	var wg sync.WaitGroup
+	for _, e := range entries {
+		wg.Go(func() { e.ping = dialPing(ctx, e.ip) })
+	}
+	wg.Wait()
+
+	failed := 0
+	for _, e := range entries {
+		if e.ping.Timeout {
+			failed++
+			fmt.Fprintf(out, "❌ %s %s: 无法连接\n", e.domain, e.ip)
+			continue
+		}
+		fmt.Fprintf(out, "✅ %s %s: %s\n", e.domain, e.ip, formatLatency(e.ping.Time))
+	}
+	if failed > 0 {
+		return fmt.Errorf("%w (%d/%d)", errConnectivity, failed, len(entries))
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// -container 指定的容器的hosts文件在宿主机上的路径。
+// Docker把容器的 /etc/hosts 挂载自宿主机上的文件，直接修改该文件即可在容器内生效，
+// 但容器重启时Docker会重新生成它（只保留 --add-host 的条目），需要重新运行
+var containerHostsPath = sync.OnceValues(func() (string, error) {
+	output, err := exec.Command("docker", "inspect", "-f", "{{.State.Running}} {{.HostsPath}}", *container).CombinedOutput()
+	if err != nil {
+		msg := strings.TrimSpace(string(output))
+		if msg == "" {
+			msg = err.Error()
+		}
+		return "", fmt.Errorf("找不到容器 %s: %s", *container, msg)
+	}
+	running, path, _ := strings.Cut(strings.TrimSpace(string(output)), " ")
+	if running != "true" {
+		return "", fmt.Errorf("容器 %s 没有在运行", *container)
+	}
+	if path == "" {
+		return "", fmt.Errorf("容器 %s 没有独立的hosts文件（可能使用了 --network host）", *container)
+	}
+	if _, err := os.Stat(path); err != nil {
+		// Docker Desktop中该路径位于虚拟机内，宿主机无法访问
+		return "", fmt.Errorf("无法访问容器的hosts文件 %s: %w (仅支持在运行Docker的Linux主机上使用)", path, err)
+	}
+	return path, nil
+})
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 诊断信息中保留的最近输出行数
+const recentLines = 200
+
+// 记录最近的输出和各域名的探测结果，程序崩溃时写入诊断文件
+var diag = &diagnostics{}
+
+type diagnostics struct {
+	mu      sync.Mutex
+	lines   []string
+	partial []byte
+	domains []string
+	results map[string]string
+}
+
+// 作为 out 的一部分，保留最近的输出行
+func (d *diagnostics) Write(p []byte) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.partial = append(d.partial, p...)
+	for {
+		i := bytes.IndexByte(d.partial, '\n')
+		if i < 0 {
+			break
+		}
+		d.lines = append(d.lines, string(d.partial[:i]))
+		d.partial = d.partial[i+1:]
+	}
+	if n := len(d.lines) - recentLines; n > 0 {
+		d.lines = d.lines[n:]
+	}
+	return len(p), nil
+}
+
+func (d *diagnostics) setDomains(domains []string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.domains = domains
+}
+
+// 记录域名最近一次的探测结果
+func (d *diagnostics) record(r Result) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.results == nil {
+		d.results = make(map[string]string)
+	}
+	if r.Error != "" {
+		d.results[r.Domain] = "error: " + r.Error
+	} else {
+		d.results[r.Domain] = "ok: " + strings.Join(r.hostIPs(), " ")
+	}
+}
+
+// 名称包含这些词的参数不写入诊断文件
+var sensitiveFlags = []string{"cookie", "token", "password", "secret"}
+
+// 写入诊断文件，返回文件路径。panicValue 为 nil 时记录导致退出的错误 fatalErr
+func writeDiagnostics(panicValue any, stack []byte, fatalErr error) (string, error) {
+	flags := make(map[string]string)
+	flag.VisitAll(func(f *flag.Flag) {
+		v := f.Value.String()
+		for _, s := range sensitiveFlags {
+			if strings.Contains(strings.ToLower(f.Name), s) {
+				v = "***"
+			}
+		}
+		flags[f.Name] = v
+	})
+
+	diag.mu.Lock()
+	report := struct {
+		Time    time.Time         `json:"time"`
+		Build   buildInfo         `json:"build"`
+		Args    []string          `json:"args"`
+		Flags   map[string]string `json:"flags"`
+		Panic   string            `json:"panic,omitempty"`
+		Error   string            `json:"error,omitempty"`
+		Stack   string            `json:"stack,omitempty"`
+		Domains []string          `json:"domains"`
+		Results map[string]string `json:"results"`
+		Log     []string          `json:"log"`
+	}{
+		Time:    time.Now().UTC(),
+		Build:   currentBuildInfo(),
+		Args:    os.Args,
+		Flags:   flags,
+		Stack:   string(stack),
+		Domains: diag.domains,
+		Results: diag.results,
+		Log:     diag.lines,
+	}
+	if panicValue != nil {
+		report.Panic = fmt.Sprint(panicValue)
+	}
+	if fatalErr != nil {
+		report.Error = fatalErr.Error()
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	diag.mu.Unlock()
+	if err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(os.TempDir(), "fastip-crash-"+time.Now().Format("20060102-150405")+".json")
+	return path, os.WriteFile(path, data, 0o644)
+}
+
+// 在main和各探测goroutine中defer调用，发生panic时写入诊断文件后退出
+func handlePanic() {
+	p := recover()
+	if p == nil {
+		return
+	}
+	stack := debug.Stack()
+	releaseLock()
+	path, err := writeDiagnostics(p, stack, nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "💥 程序异常: %v\n%s\n写入诊断信息失败: %v\n", p, stack, err)
+		os.Exit(2)
+	}
+	fmt.Fprintf(os.Stderr, "💥 程序异常: %v\n诊断信息已写入 %s，反馈问题时请附上该文件\n", p, path)
+	os.Exit(2)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"runtime"
+	"slices"
+	"strings"
+)
+
+// 没有检测到任何DNS缓存机制，最小化的系统和容器中常见，此时无需也无法刷新
+var errNoDNSCache = errors.New("未找到DNS缓存刷新工具，缓存可能未刷新")
+
+// 一种DNS缓存机制及其刷新命令
+type dnsCache struct {
+	name string
+	cmd  []string
+}
+
+// macOS按Apple文档的步骤刷新：先清空目录服务缓存，再让mDNSResponder重新加载。
+// 较新的系统上只执行后者可能刷新不完全
+func darwinDNSCaches() []dnsCache {
+	return []dnsCache{
+		{"dscacheutil", []string{"dscacheutil", "-flushcache"}},
+		{"mDNSResponder", []string{"killall", "-HUP", "mDNSResponder"}},
+	}
+}
+
+// 检测本机存在的DNS缓存机制，只返回刷新命令确实存在的项
+func linuxDNSCaches() []dnsCache {
+	var caches []dnsCache
+	if _, err := exec.LookPath("resolvectl"); err == nil {
+		caches = append(caches, dnsCache{"systemd-resolved", []string{"resolvectl", "flush-caches"}})
+	} else if _, err := exec.LookPath("systemd-resolve"); err == nil {
+		caches = append(caches, dnsCache{"systemd-resolved", []string{"systemd-resolve", "--flush-caches"}})
+	}
+	if _, err := exec.LookPath("nscd"); err == nil {
+		caches = append(caches, dnsCache{"nscd", []string{"nscd", "-i", "hosts"}})
+	}
+	if _, err := exec.LookPath("killall"); err == nil && exec.Command("pidof", "dnsmasq").Run() == nil {
+		caches = append(caches, dnsCache{"dnsmasq", []string{"killall", "-HUP", "dnsmasq"}})
+	}
+	return caches
+}
+
+// 刷新全部检测到的DNS缓存并逐项报告结果，至少一项成功即视为刷新成功
+func flushDNSCaches(interactive bool, caches []dnsCache) error {
+	if len(caches) == 0 {
+		return errNoDNSCache
+	}
+	var failed []string
+	var errs []error
+	for _, c := range caches {
+		if err := runCommand(interactive, "sudo", c.cmd...); err != nil {
+			fmt.Fprintf(out, "  ❌ %s: %v\n", c.name, err)
+			failed = append(failed, c.name)
+			errs = append(errs, err)
+			continue
+		}
+		fmt.Fprintf(out, "  ✅ %s\n", c.name)
+	}
+
+	switch {
+	case len(errs) == 0:
+		return nil
+	case len(errs) == len(caches):
+		return errors.Join(errs...)
+	}
+	fmt.Fprintf(out, "⚠️ DNS缓存部分刷新完成，以下缓存可能仍是旧数据: %s\n", strings.Join(failed, ", "))
+	return nil
+}
+
+// 运行命令，失败时以命令的输出作为错误信息
+func runCommand(interactive bool, name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	if interactive {
+		cmd.Stdin = os.Stdin
+	}
+	output, err := cmd.CombinedOutput()
+	if err == nil {
+		return nil
+	}
+	if msg := strings.TrimSpace(string(output)); msg != "" {
+		return fmt.Errorf("%w: %s", err, msg)
+	}
+	return err
+}
+
+// 常见的权限不足提示，包括sudo无法询问密码和Windows的拒绝访问
+var permissionMessages = []string{
+	"permission denied",
+	"operation not permitted",
+	"a password is required",
+	"a terminal is required",
+	"not in the sudoers",
+	"authentication",
+	"access is denied",
+	"requires elevation",
+	"拒绝访问",
+	"需要提升",
+}
+
+// 判断错误是否由权限不足引起
+func isPermissionError(err error) bool {
+	if errors.Is(err, fs.ErrPermission) {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	return slices.ContainsFunc(permissionMessages, func(s string) bool { return strings.Contains(msg, s) })
+}
+
+// 权限不足时的操作建议
+func privilegeHint() string {
+	if runtime.GOOS == "windows" {
+		return "请以管理员身份运行（右键“以管理员身份运行”终端），或使用 -elevate"
+	}
+	return "请使用 sudo 重新运行，或使用 -elevate"
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// 提权后重新运行的进程带有该环境变量，避免反复提权
+const elevatedEnv = "FASTIP_ELEVATED"
+
+// 没有写入hosts的权限时，经用户确认或指定 -elevate 后以管理员权限重新运行。
+// 不提权时照常继续，写入失败会在之后提示
+func ensureHostsWritable() {
+	path, err := hostsFilePath()
+	if err != nil {
+		return
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err == nil {
+		f.Close()
+		return
+	}
+	if !errors.Is(err, fs.ErrPermission) || os.Getenv(elevatedEnv) != "" {
+		return
+	}
+	if runtime.GOOS != "windows" && os.Geteuid() == 0 {
+		// root仍无法写入多半是不可修改属性，提权没有帮助，写入时会给出提示
+		return
+	}
+
+	if !*elevate {
+		if !canPrompt() {
+			fmt.Fprintf(out, "⚠️ 没有写入 %s 的权限，可使用 -elevate 自动提权\n", path)
+			return
+		}
+		if !confirm(fmt.Sprintf("没有写入 %s 的权限，是否以管理员权限重新运行? [y/N]: ", path)) {
+			return
+		}
+	}
+
+	code, err := relaunchElevated()
+	if err != nil {
+		fmt.Fprintf(out, "⚠️ 提权失败: %v，继续以当前权限运行\n", err)
+		return
+	}
+	os.Exit(code)
+}
+
+// 以管理员权限使用相同的参数重新运行本程序，返回其退出码
+func relaunchElevated() (int, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return 0, err
+	}
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		// 通过PowerShell触发UAC，新进程在单独的窗口中运行
+		args := make([]string, 0, len(os.Args)-1)
+		for _, a := range os.Args[1:] {
+			args = append(args, "'"+strings.ReplaceAll(a, "'", "''")+"'")
+		}
+		script := fmt.Sprintf("$env:%s='1'; $p = Start-Process -FilePath '%s' -Verb RunAs -Wait -PassThru", elevatedEnv, strings.ReplaceAll(exe, "'", "''"))
+		if len(args) > 0 {
+			script += " -ArgumentList " + strings.Join(args, ",")
+		}
+		cmd = exec.Command("powershell", "-NoProfile", "-Command", script+"; exit $p.ExitCode")
+	} else {
+		if _, err := exec.LookPath("sudo"); err != nil {
+			return 0, fmt.Errorf("未找到sudo，请以root身份重新运行")
+		}
+		cmd = exec.Command("sudo", append([]string{"env", elevatedEnv + "=1", exe}, os.Args[1:]...)...)
+	}
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+
+	fmt.Fprintln(out, "🔐 以管理员权限重新运行...")
+	err = cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), nil
+	}
+	return 0, err
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"net"
+	"strings"
+)
+
+// 探测失败的类别
+const (
+	errKindDNS     = "dns"     // 域名解析失败
+	errKindConnect = "connect" // 无法建立连接
+	errKindTLS     = "tls"     // TLS握手或证书错误
+	errKindTimeout = "timeout" // 超过 -timeout
+	errKindRead    = "read"    // 连接建立后读取失败
+	errKindParse   = "parse"   // 页面或数据无法解析
+)
+
+// chromedp返回的是Chrome的网络错误文本，按错误码前缀归类
+var chromeNetErrors = []struct{ prefix, kind string }{
+	{"net::ERR_NAME_NOT_RESOLVED", errKindDNS},
+	{"net::ERR_NAME_RESOLUTION_FAILED", errKindDNS},
+	{"net::ERR_CERT_", errKindTLS},
+	{"net::ERR_SSL_", errKindTLS},
+	{"net::ERR_TIMED_OUT", errKindTimeout},
+	{"net::ERR_CONNECTION_TIMED_OUT", errKindTimeout},
+	{"net::ERR_CONNECTION_", errKindConnect},
+	{"net::ERR_ADDRESS_UNREACHABLE", errKindConnect},
+	{"net::ERR_INTERNET_DISCONNECTED", errKindConnect},
+	{"net::ERR_EMPTY_RESPONSE", errKindRead},
+}
+
+// 把数据来源返回的错误归类，便于判断是网络问题还是页面变化。无法识别时返回空
+func classifyError(err error) string {
+	var (
+		dnsErr  *net.DNSError
+		opErr   *net.OpError
+		certErr *tls.CertificateVerificationError
+		x509Err x509.UnknownAuthorityError
+		recErr  tls.RecordHeaderError
+		synErr  *json.SyntaxError
+		typeErr *json.UnmarshalTypeError
+	)
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return errKindTimeout
+	case errors.As(err, &dnsErr):
+		return errKindDNS
+	case errors.As(err, &certErr), errors.As(err, &x509Err), errors.As(err, &recErr):
+		return errKindTLS
+	case errors.As(err, &opErr):
+		if opErr.Timeout() {
+			return errKindTimeout
+		}
+		if opErr.Op == "dial" {
+			return errKindConnect
+		}
+		return errKindRead
+	case errors.As(err, &synErr), errors.As(err, &typeErr):
+		return errKindParse
+	}
+
+	msg := err.Error()
+	for _, e := range chromeNetErrors {
+		if strings.Contains(msg, e.prefix) {
+			return e.kind
+		}
+	}
+	return ""
+}
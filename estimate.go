@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+)
+
+// 在本机分别测量系统DNS当前解析到的IP和选出的IP的连接时间，估算修改hosts的收益。
+// 两者都在本机测量，比直接比较itdog节点的延迟更能反映本机的实际变化。
+// 提升不足 -min-improvement 时返回false，调用方不应修改该域名的条目
+func estimateImprovement(ctx context.Context, r *Result) bool {
+	addrs, err := net.DefaultResolver.LookupHost(ctx, r.Domain)
+	if err != nil || len(addrs) == 0 {
+		fmt.Fprintf(out, "📈 %s: 无法解析当前IP (%v)，按新增处理\n", r.Domain, err)
+		return true
+	}
+
+	// 系统可能返回多个IP，取其中最快的作为当前水平
+	current, currentMs := "", 0.0
+	for _, ip := range addrs {
+		if p := dialPing(ctx, ip); !p.Timeout && (current == "" || p.Time < currentMs) {
+			current, currentMs = ip, p.Time
+		}
+	}
+	best := dialPing(ctx, r.IP)
+	switch {
+	case best.Timeout:
+		fmt.Fprintf(out, "📈 %s: 本机无法连接 %s，不建议修改\n", r.Domain, r.IP)
+		return false
+	case current == "":
+		fmt.Fprintf(out, "📈 %s: 当前IP %v 均无法连接，%s 为 %s，建议修改\n", r.Domain, addrs, r.IP, formatLatency(best.Time))
+		return true
+	}
+
+	gain := currentMs - best.Time
+	msg := fmt.Sprintf("📈 %s: 当前 %s %s -> %s %s", r.Domain, current, formatLatency(currentMs), r.IP, formatLatency(best.Time))
+	if gain < *minImprovement {
+		fmt.Fprintf(out, "%s，提升 %s 不足 %s，不建议修改\n", msg, formatLatency(gain), formatLatency(*minImprovement))
+		return false
+	}
+	fmt.Fprintf(out, "%s，预计提升 %s (%.0f%%)，建议修改\n", msg, formatLatency(gain), gain/currentMs*100)
+	return true
+}
+
+// hosts管理区块中当前的条目，读取失败时返回空
+func currentHostsEntries() map[string][]string {
+	path, err := hostsFilePath()
+	if err != nil {
+		return nil
+	}
+	lines, err := readHostsLines(path)
+	if err != nil {
+		fmt.Fprintf(out, "⚠️ 读取hosts失败: %v，-write-if-faster 不生效\n", err)
+		return nil
+	}
+	return blockEntries(managedBlock(lines))
+}
+
+// -write-if-faster：在本机分别测量hosts中当前的IP和选出的IP，
+// 只有选出的IP确实更快时才写入，避免itdog节点与本机线路不一致时越改越慢。
+// 还没有条目或当前IP无法连接时直接写入
+func fasterThanCurrent(ctx context.Context, r *Result, current []string) bool {
+	if len(current) == 0 || current[0] == r.IP {
+		return true
+	}
+	old, best := dialPing(ctx, current[0]), dialPing(ctx, r.IP)
+	switch {
+	case old.Timeout:
+		fmt.Fprintf(out, "⚡ %s: 当前的 %s 无法连接，改用 %s\n", r.Domain, current[0], r.IP)
+		return true
+	case best.Timeout || best.Time >= old.Time:
+		latency := "无法连接"
+		if !best.Timeout {
+			latency = formatLatency(best.Time)
+		}
+		fmt.Fprintf(out, "⚡ %s: 本机测得 %s (%s) 不比当前的 %s (%s) 快，保持不变\n", r.Domain, r.IP, latency, current[0], formatLatency(old.Time))
+		return false
+	}
+	fmt.Fprintf(out, "⚡ %s: 本机测得 %s (%s) 比当前的 %s (%s) 快\n", r.Domain, r.IP, formatLatency(best.Time), current[0], formatLatency(old.Time))
+	return true
+}
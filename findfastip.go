@@ -3,87 +3,1098 @@ package main
 import (
 	"bufio"
 	"context"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"io/fs"
 	"log"
+	"maps"
+	"net"
 	"os"
 	"os/exec"
+	"regexp"
 	"runtime"
+	"slices"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/chromedp/chromedp"
 )
 
 func main() {
+	defer handlePanic()
+
+	if len(os.Args) > 1 {
+		var cmd func([]string) error
+		switch os.Args[1] {
+		case "history":
+			cmd = historyCmd
+		case "bench":
+			cmd = benchCmd
+		case "normalize":
+			cmd = normalizeCmd
+		case "backups":
+			cmd = backupsCmd
+		}
+		if cmd != nil {
+			if err := cmd(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+	}
+
+	flag.Parse()
+	if *showVersion {
+		if err := printVersion(); err != nil {
+			fatal(err)
+		}
+		return
+	}
+	if *jsonPretty || *quietJSON {
+		*jsonOut = true
+	}
+	if *stdinList && *interactive {
+		fatal(errors.New("-stdin 与 -interactive 都需要读取标准输入，不能同时使用"))
+	}
+	switch *format {
+	case "text":
+		if *jsonOut {
+			*format = "json"
+		}
+	case "json":
+		*jsonOut = true
+	case "switchhosts":
+		// 只输出SwitchHosts导入数据，不修改hosts
+		*dryRun = true
+		*jsonOut = false
+		out = os.Stderr
+	default:
+		fatal(fmt.Errorf("不支持的输出格式: %s (可选 text|json|switchhosts)", *format))
+	}
+	if *hostsOnly != "" {
+		// 只生成hosts片段，不读取也不修改系统的hosts
+		*dryRun = true
+		if *hostsOnly == "-" {
+			if *jsonOut {
+				fatal(errors.New("-output-hosts-only - 与JSON输出都使用标准输出，不能同时使用"))
+			}
+			out = os.Stderr
+		}
+	}
+	if *testType != "ping" && *testType != "http" {
+		fatal(fmt.Errorf("不支持的测试类型: %s (可选 ping|http)", *testType))
+	}
+	if *templateText != "" {
+		if err := parseResultTemplate(*templateText); err != nil {
+			fatal(fmt.Errorf("解析 -template 失败: %w", err))
+		}
+	}
+	if *skipRegex != "" {
+		re, err := regexp.Compile(*skipRegex)
+		if err != nil {
+			fatal(fmt.Errorf("-skip-regex 不是合法的正则表达式: %w", err))
+		}
+		skipPattern = re
+	}
+	if *blockPosition != "top" && *blockPosition != "bottom" {
+		fatal(fmt.Errorf("不支持的区块位置: %s (可选 top|bottom)", *blockPosition))
+	}
+	switch *mergeStrategy {
+	case "replace-all", "first-wins", "last-wins":
+	default:
+		fatal(fmt.Errorf("不支持的合并策略: %s (可选 replace-all|first-wins|last-wins)", *mergeStrategy))
+	}
+	switch *onNoCandidate {
+	case "skip", "keep", "remove":
+	default:
+		fatal(fmt.Errorf("不支持的处理方式: %s (可选 skip|keep|remove)", *onNoCandidate))
+	}
+	if *dials > 1 && *providerName != "local" {
+		fatal(errors.New("-dials 只适用于 -provider local"))
+	}
+	ports, err := parsePorts(*probePorts)
+	if err != nil {
+		fatal(fmt.Errorf("解析 -probe-ports 失败: %w", err))
+	}
+	probePortList = ports
+	if *retryMultiplier < 0 {
+		fatal(errors.New("-retry-multiplier 不能为负数"))
+	}
+	if *retryJitter < 0 || *retryJitter > 1 {
+		fatal(errors.New("-retry-jitter 必须在0到1之间"))
+	}
+	if *probeTimeout <= 0 {
+		fatal(errors.New("-probe-timeout 必须大于0"))
+	}
+	if err := validateLatencyUnit(); err != nil {
+		fatal(err)
+	}
+	if *jsonOut {
+		// JSON独占标准输出，其余信息输出到标准错误
+		out = os.Stderr
+	}
+	if *printIP {
+		// 标准输出只有IP，其余信息全部丢弃，错误仍输出到标准错误
+		out = io.Discard
+		*quiet = true
+	}
+	if *quietJSON {
+		// 只输出最终的JSON，其余信息全部丢弃
+		out = io.Discard
+		*quiet = true
+	}
+	if *logFile != "" {
+		f, err := os.OpenFile(*logFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+		if err != nil {
+			fatal(err)
+		}
+		defer f.Close()
+		out = io.MultiWriter(out, f)
+	}
+	out = io.MultiWriter(out, diag)
+
+	if *connectivity {
+		if err := checkConnectivity(context.Background()); err != nil {
+			fatal(err)
+		}
+		return
+	}
+	if *restore != "" {
+		if err := restoreHosts(*restore); err != nil {
+			fatal(err)
+		}
+		flushDNS()
+		return
+	}
+
+	switch *network {
+	case "auto":
+		ipv6Only = !hasIPv4Route()
+	case "ipv6-only":
+		ipv6Only = true
+	case "dual":
+	default:
+		fatal(fmt.Errorf("不支持的网络类型: %s (可选 auto|dual|ipv6-only)", *network))
+	}
+	if ipv6Only {
+		fmt.Fprintln(out, "🌐 网络: 仅IPv6，只选择IPv6候选IP")
+	} else {
+		fmt.Fprintln(out, "🌐 网络: IPv4可用")
+	}
+
+	w, err := parseScoreFormula(*scoreFormula)
+	if err != nil {
+		fatal(err)
+	}
+	scoreWeights = w
+	if *blocklistFile != "" {
+		if err := loadBlocklist(*blocklistFile); err != nil {
+			fatal(err)
+		}
+	}
+	if *nodeRegionMapFile != "" {
+		if err := loadNodeRegionMap(*nodeRegionMapFile); err != nil {
+			fatal(err)
+		}
+	}
+
+	if *container != "" {
+		path, err := hostsFilePath()
+		if err != nil {
+			fatal(err)
+		}
+		fmt.Fprintf(out, "🐳 写入容器 %s 的hosts: %s (容器重启后需重新运行)\n", *container, path)
+	}
+
+	if *printIP {
+		ctx, provider, cancel, err := newProvider()
+		if err != nil {
+			fatal(err)
+		}
+		err = printBestIP(ctx, provider)
+		cancel()
+		if err != nil {
+			fatal(err)
+		}
+		return
+	}
+
+	if *benchmark {
+		ctx, provider, cancel, err := newProvider()
+		if err != nil {
+			fatal(err)
+		}
+		err = runBenchmark(ctx, provider)
+		cancel()
+		if err != nil {
+			fatal(err)
+		}
+		return
+	}
+
+	// 探测可能要几分钟，先确认能写入hosts，避免探测完才发现缺少权限
+	if !*dryRun && *compareTo == "" {
+		ensureHostsWritable()
+	}
+
+	// 整个运行期间（包括探测）持有实例锁
+	release, err := acquireLock(*lockFile, *force)
+	if err != nil {
+		fatal(err)
+	}
+	releaseLock = release
+	defer release()
+
+	ctx, provider, cancel, err := newProvider()
+	if err != nil {
+		fatal(err)
+	}
+
+	if *watch > 0 {
+		defer cancel()
+		watchLoop(ctx, provider)
+		return
+	}
+
+	err = run(ctx, provider)
+	cancel()
+	if err != nil {
+		fatal(err)
+	}
+}
+
+// -print-ip：最简单的脚本接口，只探测 -domain 并在标准输出打印最快的IP，
+// 不修改hosts。找不到IP时以非零状态退出，便于 X=$(fastip -domain github.com -print-ip)
+func printBestIP(ctx context.Context, provider LatencyProvider) error {
+	r := probeDomain(ctx, provider, *domainFlag)
+	if r.Error != "" {
+		return fmt.Errorf("%s: %s", r.Domain, r.Error)
+	}
+	fmt.Println(r.IP)
+	return nil
+}
+
+// 结果JSON是否已经输出
+var jsonPrinted bool
+
+// 释放实例锁，os.Exit不会执行defer，退出前需要手动调用
+var releaseLock = func() {}
+
+// 以非零状态退出。-quiet-json 时错误也以JSON输出到标准输出，
+// 已经输出过结果JSON（结果中已包含各域名的错误）时不再输出。
+// 参数错误、-compare-to 不一致等预期的结果只输出错误，程序内部的意外错误才写入诊断文件
+func fatal(err error) {
+	releaseLock()
+	if !*quietJSON {
+		log.Print(err)
+	} else if !jsonPrinted {
+		data, _ := json.Marshal(map[string]string{"error": err.Error()})
+		fmt.Println(string(data))
+	}
+	if ie := (internalError{}); errors.As(err, &ie) {
+		if path, derr := writeDiagnostics(nil, nil, err); derr == nil {
+			fmt.Fprintf(os.Stderr, "诊断信息已写入 %s，反馈问题时请附上该文件\n", path)
+		}
+	}
+	os.Exit(1)
+}
+
+// 程序内部的意外错误，不是参数、环境或探测结果导致的，退出时写入诊断文件
+type internalError struct{ err error }
+
+func (e internalError) Error() string { return e.err.Error() }
+func (e internalError) Unwrap() error { return e.err }
+
+var errFailFast = errors.New("存在失败的域名，已提前终止")
+
+var errIncomplete = errors.New("存在失败的域名，未修改hosts")
+
+// 按 -domain、-config、-batch、-stdin 的顺序确定要探测的域名，后者覆盖前者
+func collectDomains(base context.Context) ([]string, error) {
+	domains := []string{*domainFlag}
+	var err error
+	if *configFile != "" {
+		domains, err = loadConfig(*configFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if *batchFile != "" {
+		domains, err = loadDomains(*batchFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if *stdinList {
+		domains, err = stdinDomains()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if *followCNAME {
+		domains = appendCNAMETargets(base, domains)
+	}
+	return skipMatching(domains), nil
+}
+
+// 完整运行一轮：探测全部域名、写入hosts并刷新DNS
+func run(base context.Context, provider LatencyProvider) error {
+	start := time.Now()
+	timer = new(phaseTimer)
+	domains, err := collectDomains(base)
+	timer.since(phaseResolve, start)
+	if err != nil {
+		return err
+	}
+	diag.setDomains(domains)
+
+	// 批量模式下逐条写入状态文件，中断后可通过 -resume 继续
+	var state *stateWriter
+	var resumed []Result
+	if *batchFile != "" {
+		var done map[string]Result
+		state, done, err = openState(*stateFile, *resume)
+		if err != nil {
+			return err
+		}
+		defer state.Close()
+
+		var pending []string
+		for _, domain := range domains {
+			if r, ok := done[domain]; ok {
+				resumed = append(resumed, r)
+				fmt.Fprintf(out, "⏭️ 跳过已完成: %s\n", domain)
+				continue
+			}
+			pending = append(pending, domain)
+		}
+		domains = pending
+	}
+
+	if *stickyWindow > 0 {
+		var err error
+		stickyCache, err = loadCache(*cacheFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	// -write-if-faster 需要与hosts中当前的IP比较
+	var current map[string][]string
+	if *writeIfFaster {
+		current = currentHostsEntries()
+	}
+
+	// -require-all-domains 时先暂存全部结果，确认都成功后才写入
+	every := *flushEvery
+	if *requireAll {
+		every = 0
+	}
+	hosts := newHostsWriter(every)
+	// 上次运行已完成的域名不再探测，但其结果可能还没有写入hosts
+	for _, r := range resumed {
+		hosts.Add(r.Domain, r.hostIPs())
+	}
+
+	// -estimate 和 -write-if-faster：本机测得新IP没有改善时不写入
+	worthWriting := func(ctx context.Context, r *Result) bool {
+		worth := true
+		if *estimate {
+			worth = estimateImprovement(ctx, r)
+		}
+		if *writeIfFaster && worth {
+			worth = fasterThanCurrent(ctx, r, current[r.Domain])
+		}
+		return worth
+	}
+	groups := parseSharedGroups(*sharedIPDomains)
+
+	// -fail-fast 时任一域名失败即取消其余探测。并发探测中的域名会随ctx取消
+	// 尽快返回，等它们全部退出后再返回错误；尚未开始的域名不再探测。
+	// 因此 -concurrency 越大，失败前已经开始的探测越多，结果中记为"已取消"
+	ctx, stop := context.WithCancel(base)
+	defer stop()
+	var failOnce sync.Once
+	var failed string
+	var stateOnce sync.Once
+	var stateErr error
+
+	// 结果按输入顺序存放，并发时输出仍保持稳定
+	results := make([]Result, len(domains))
+	prog := newProgress(domains)
+	prog.Capture()
+	probeStart := time.Now()
+	sem := make(chan struct{}, max(*concurrency, 1))
+	var wg sync.WaitGroup
+	for i, domain := range domains {
+		sem <- struct{}{}
+		if ctx.Err() != nil {
+			<-sem
+			results[i] = Result{Domain: domain, Error: canceledMsg}
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer handlePanic()
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			prog.Start(domain)
+			r := probeDomain(ctx, provider, domain)
+			if r.Error != "" && ctx.Err() != nil {
+				// 被其他域名的失败取消，不算作本域名的错误
+				r.Error = canceledMsg
+			}
+			verifyStart := time.Now()
+			if *verify && r.Error == "" {
+				verifyResult(ctx, &r)
+			}
+			if *interactive && r.Error == "" {
+				chooseIP(&r)
+			}
+			results[i] = r
+			diag.record(r)
+			if !prog.dashboard {
+				// 状态表中已经显示了结果
+				printResult(r)
+			}
+			// 共用IP的域名要等选定共同的IP后再判断
+			worth := true
+			if r.Error == "" && !groups.contains(r.Domain) {
+				worth = worthWriting(ctx, &r)
+			}
+			timer.since(phaseVerify, verifyStart)
+			prog.Done(r)
+			if state != nil && r.Error != canceledMsg {
+				if err := state.Write(r); err != nil {
+					// 不能在探测协程中退出，停止探测后由主流程报告
+					stateOnce.Do(func() {
+						stateErr = fmt.Errorf("写入状态文件失败: %w", err)
+						stop()
+					})
+				}
+			}
+			if r.Error != "" && r.Error != canceledMsg && *failFast {
+				failOnce.Do(func() {
+					failed = r.Domain
+					stop()
+				})
+			}
+			// 共用IP的域名要等全部探测完成后统一选择
+			if r.Error == "" && worth && !groups.contains(r.Domain) {
+				hosts.Add(r.Domain, r.hostIPs())
+			}
+			if *onNoCandidate == "remove" && noCandidate(r) {
+				hosts.Add(r.Domain, nil)
+			}
+		}()
+	}
+	wg.Wait()
+	prog.Finish()
+	timer.since(phaseProbe, probeStart)
+	if stateErr != nil {
+		return stateErr
+	}
+	// -fail-fast 中止整个运行，不再写入hosts和刷新DNS
+	if failed != "" {
+		return fmt.Errorf("%w: %s", errFailFast, failed)
+	}
+
+	for _, group := range groups {
+		for _, i := range assignSharedIP(ctx, results, group) {
+			if worthWriting(ctx, &results[i]) {
+				hosts.Add(results[i].Domain, results[i].hostIPs())
+			}
+		}
+	}
+
+	// 同一IP被用于多个不相关的域名时可能是错误的结果
+	if conflicts := checkSharedIPs(results, groups); conflicts > 0 && *strict {
+		return fmt.Errorf("%d 个IP被多个不相关的域名共用 (-strict)", conflicts)
+	}
+
+	var incomplete []string
+	if *requireAll {
+		for _, r := range results {
+			if r.Error != "" {
+				incomplete = append(incomplete, r.Domain)
+			}
+		}
+	}
+
+	// 写入剩余的结果，hosts有变化时刷新DNS
+	if len(incomplete) == 0 {
+		hosts.Flush()
+	} else {
+		fmt.Fprintf(out, "⛔ %d 个域名没有得到有效IP，按 -require-all-domains 不修改hosts\n", len(incomplete))
+	}
+	if hosts.written && hosts.changed() {
+		// 刷新DNS会影响其他程序，写入的IP全都无法连接时不刷新
+		if *verifyBeforeFlush && !anyReachable(base, hosts.snapshot()) {
+			fmt.Fprintln(out, "⚠️ 写入的IP均无法连接，跳过刷新DNS缓存")
+		} else {
+			if *verifyBeforeFlush {
+				fmt.Fprintln(out, "✅ 写入的IP可以连接，继续刷新DNS缓存")
+			}
+			flushWithCooldown()
+		}
+	} else if flushPending {
+		// 之前因冷却推迟的刷新
+		flushWithCooldown()
+	}
+	for i := range results {
+		results[i].Action = hosts.actions[results[i].Domain]
+		if *onNoCandidate == "keep" && noCandidate(results[i]) {
+			results[i].Action = actionKept
+		}
+	}
+	if *notify {
+		notifyChanges(results)
+	}
+	if resultTemplate != nil {
+		for _, r := range results {
+			if err := renderResult(r); err != nil {
+				return fmt.Errorf("渲染 -template 失败: %w", err)
+			}
+		}
+	}
+
+	// -echo 时输出实际写入的区块，JSON模式下放进JSON结果中
+	var echoed []string
+	if *echo && hosts.written {
+		echoed = hosts.block
+		if !*jsonOut {
+			fmt.Println()
+			for _, line := range echoed {
+				fmt.Println(line)
+			}
+		}
+	}
+
+	// 记录最近一次成功的结果供 -offline 使用，并追加到历史记录
+	if *providerName != "mock" && !*offline && *replayDir == "" {
+		if err := updateCache(*cacheFile, results); err != nil {
+			fmt.Fprintf(out, "⚠️ 更新缓存失败: %v\n", err)
+		}
+		if *historyFile != "" {
+			if err := appendHistory(*historyFile, results); err != nil {
+				fmt.Fprintf(out, "⚠️ 写入历史记录失败: %v\n", err)
+			}
+		}
+	}
+
+	var stats *Stats
+	if *showStats {
+		stats = computeStats(results)
+		printStats(stats)
+	}
+	var timing *Timing
+	if *showTiming {
+		timing = timer.report(time.Since(start))
+		printTiming(timing)
+	}
+
+	if *jsonOut {
+		data, err := marshalJSON(reportValue(results, stats, echoed, timing))
+		if err != nil {
+			return internalError{fmt.Errorf("生成JSON结果失败: %w", err)}
+		}
+		fmt.Println(string(data))
+		jsonPrinted = true
+	}
+	if *format == "switchhosts" {
+		data, err := switchHostsJSON(hosts.snapshot())
+		if err != nil {
+			return internalError{fmt.Errorf("生成SwitchHosts配置失败: %w", err)}
+		}
+		fmt.Println(string(data))
+	}
+	if *hostsOnly != "" && len(incomplete) == 0 {
+		if err := writeHostsFragment(*hostsOnly, hosts.snapshot()); err != nil {
+			return err
+		}
+	}
+	if *reportFile != "" {
+		if err := writeReport(*reportFile, results, stats); err != nil {
+			fmt.Fprintf(out, "⚠️ 写入报告失败: %v\n", err)
+		}
+	}
+
+	if len(incomplete) > 0 {
+		return fmt.Errorf("%w: %s", errIncomplete, strings.Join(incomplete, ", "))
+	}
+	if *compareTo != "" {
+		return compareResults(*compareTo, results)
+	}
+	return nil
+}
+
+// 按 -json-pretty 决定是否缩进，默认紧凑输出便于管道处理
+func marshalJSON(v any) ([]byte, error) {
+	if *jsonPretty {
+		return json.MarshalIndent(v, "", "  ")
+	}
+	return json.Marshal(v)
+}
+
+// 启动无头浏览器
+func newBrowser() (context.Context, context.CancelFunc, error) {
 	opts := append(chromedp.DefaultExecAllocatorOptions[:],
 		chromedp.Flag("headless", true),
 		chromedp.UserAgent("Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36"),
 	)
 
-	ctx, cancel := chromedp.NewExecAllocator(context.Background(), opts...)
-	defer cancel()
+	allocCtx, allocCancel := chromedp.NewExecAllocator(context.Background(), opts...)
+	ctx, ctxCancel := chromedp.NewContext(allocCtx)
+	cancel := func() {
+		ctxCancel()
+		allocCancel()
+	}
 
-	ctx, cancel = chromedp.NewContext(ctx)
-	defer cancel()
-	ctx, cancel = context.WithTimeout(ctx, 60*time.Second)
+	// 先启动浏览器，之后每个域名在其中打开新标签页
+	if err := chromedp.Run(ctx); err != nil {
+		cancel()
+		return nil, nil, err
+	}
+	return ctx, cancel, nil
+}
+
+// 因 -fail-fast 被取消的域名的错误信息
+const canceledMsg = "已取消"
+
+// 单个域名的探测结果
+type Result struct {
+	Domain  string   `json:"domain"`
+	IP      string   `json:"ip,omitempty"` // 平均延迟最低的IP
+	Latency float64  `json:"-"`            // 平均延迟(ms)
+	IPs     []string `json:"ips,omitempty"`
+	Error   string   `json:"error,omitempty"`
+	ErrKind string   `json:"error_kind,omitempty"` // 探测失败的类别: dns|connect|tls|timeout|read|parse
+
+	Action string `json:"action,omitempty"` // hosts条目的变化: added|updated|unchanged|manual|kept|removed
+
+	Top        []string `json:"top,omitempty"` // -top 大于1时写入hosts的全部IP，第一个即IP
+	Candidates []IPStat `json:"-"`             // 按平均延迟排序的全部候选IP
+}
+
+// 探测成功但没有合适的IP，区别于网络错误等查询本身的失败
+func noCandidate(r Result) bool {
+	switch r.Error {
+	case ErrNoDomesticIP.Error(), ErrAllTimeout.Error(), ErrRegionsFiltered.Error(), ErrNoIPv6.Error(), ErrUnreachable.Error():
+		return true
+	}
+	return false
+}
+
+// 要写入hosts的IP
+func (r Result) hostIPs() []string {
+	if len(r.Top) > 0 {
+		return r.Top
+	}
+	return []string{r.IP}
+}
+
+// 序列化时按 -latency-unit 换算延迟并标注单位
+func (r Result) MarshalJSON() ([]byte, error) {
+	type plain Result
+	v := struct {
+		plain
+		Latency float64 `json:"latency,omitempty"`
+		Unit    string  `json:"latency_unit,omitempty"`
+	}{plain: plain(r)}
+	if r.IP != "" {
+		v.Latency = latencyIn(r.Latency)
+		v.Unit = *latencyUnit
+	}
+	return json.Marshal(v)
+}
+
+// 获取域名的检测结果并选出最快的IP
+func probeDomain(ctx context.Context, provider LatencyProvider, domain string) Result {
+	r := Result{Domain: domain}
+
+	s := settingsFor(domain)
+
+	// 超时时间是包括重试在内的硬上限
+	ctx, cancel := context.WithTimeout(ctx, s.Timeout)
 	defer cancel()
 
-	var ips string
-	err := chromedp.Run(ctx,
-		chromedp.Navigate("https://www.itdog.cn/ping/github.com"),
-		chromedp.Click(`//button[contains(text(),'单次测试')]`, chromedp.NodeVisible),
-		chromedp.WaitVisible(`a.copy_ip`),
-		chromedp.AttributeValue(`a.copy_ip`, "copy-text", &ips, nil),
-	)
+	ips, pings, err := probeRepeated(ctx, provider, domain, max(*probeCount, 1))
+	if err != nil {
+		r.Error = err.Error()
+		r.ErrKind = classifyError(err)
+		return r
+	}
+	if *strictValidation {
+		pings = validatePings(domain, pings)
+	}
+	pings = dropInvalidIPs(domain, pings)
+	r.IPs = slices.DeleteFunc(ips, func(ip string) bool { return validCandidateIP(net.ParseIP(ip)) != nil })
 
+	if s.ISP != "" {
+		pings = filterISP(pings, s.ISP)
+	}
+	if *regions != "" {
+		filtered := filterRegions(pings, strings.Split(*regions, ","))
+		switch {
+		case len(filtered) > 0 || len(pings) == 0:
+			pings = filtered
+		case *retryOnEmptyRegions:
+			// 地区过滤去掉了全部节点，多半是 -regions 配置有误，退回使用全部节点
+			fmt.Fprintf(out, "⚠️ %s: -regions 过滤后没有节点，改为使用全部 %d 个节点\n", domain, len(pings))
+		default:
+			r.Error = ErrRegionsFiltered.Error()
+			return r
+		}
+	}
+	if ipv6Only {
+		// 没有IPv4路由时写入IPv4条目没有意义
+		pings = onlyIPv6(pings)
+		if len(pings) == 0 {
+			r.Error = ErrNoIPv6.Error()
+			return r
+		}
+	}
+	if *sampleK > 0 {
+		pings = sampleNodes(pings, *sampleK, nodeRand(domain))
+	}
+	if *maxCandidates > 0 {
+		pings = limitCandidates(pings, *maxCandidates)
+	}
+	if *probeCount > 1 {
+		fmt.Fprintf(out, "📊 %s: 合并 %d 次探测，共 %d 个节点样本\n", domain, *probeCount, len(pings))
+	}
+	r.Candidates = rankIPs(pings)
+	r.IP, r.Latency, err = findFastestIP(pings)
 	if err != nil {
-		log.Fatal(err)
+		r.Error = err.Error()
+		return r
+	}
+	if s.Top > 1 {
+		top := pickTop(r.Candidates, s.Top, s.PreferRegion)
+		r.IP, r.Latency = top[0].IP, top[0].Avg
+		for _, c := range top {
+			r.Top = append(r.Top, c.IP)
+		}
+	}
+	if *stickyWindow > 0 {
+		applySticky(&r)
+	}
+	if *dualWrite {
+		addOtherFamily(&r)
+	}
+	return r
+}
+
+// 对同一域名探测n次并合并所有节点的结果，IP列表去重，之后按IP汇总即为多次的平均。
+// 每次之间间隔 -runs-interval，避免触发itdog的限流。部分探测失败时使用其余的结果，
+// 全部失败才返回错误；超时后不再继续，已有的结果仍然有效
+func probeRepeated(ctx context.Context, provider LatencyProvider, domain string, n int) ([]string, []PingResult, error) {
+	var (
+		ips     []string
+		pings   []PingResult
+		lastErr error
+		ok      bool
+	)
+	for i := range n {
+		if i > 0 && *runsInterval > 0 {
+			select {
+			case <-time.After(*runsInterval):
+			case <-ctx.Done():
+			}
+		}
+		if ctx.Err() != nil && ok {
+			verbosef("%s: 超时，只使用前 %d 次探测的结果\n", domain, i)
+			break
+		}
+
+		queryStart := time.Now()
+		got, p, err := provider.Probe(ctx, domain)
+		timer.since(phaseQuery, queryStart)
+		if err != nil {
+			if ctx.Err() != nil {
+				if ok {
+					break
+				}
+				return nil, nil, err
+			}
+			verbosef("%s: 第 %d 次探测失败: %v\n", domain, i+1, err)
+			lastErr = err
+			continue
+		}
+		ok = true
+		for _, ip := range got {
+			if !slices.Contains(ips, ip) {
+				ips = append(ips, ip)
+			}
+		}
+		pings = append(pings, p...)
+	}
+	if !ok {
+		return nil, nil, lastErr
 	}
+	return ips, pings, nil
+}
 
-	// 提取IP并保存到host
-	ipList := strings.Split(ips, "\n")
-	var host []string
+// 人类可读信息的输出位置
+var (
+	out     io.Writer = os.Stdout
+	printMu sync.Mutex
+)
+
+// 仅在 -verbose 时输出的调试信息
+func verbosef(format string, a ...any) {
+	if *verbose {
+		fmt.Fprintf(out, "🔍 "+format, a...)
+	}
+}
+
+// 打印单个域名的结果
+func printResult(r Result) {
+	if resultTemplate != nil {
+		// 使用模板时等hosts写入完成、Action确定后统一输出
+		return
+	}
+
+	// 并发时避免多个域名的输出交错
+	printMu.Lock()
+	defer printMu.Unlock()
 
-	fmt.Println("提取到的IP地址：")
-	for i, ip := range ipList {
-		ip = strings.TrimSpace(ip)
-		if ip != "" {
-			fmt.Printf("%2d: %s\n", i+1, ip)
-			host = append(host, ip)
+	if r.Error != "" {
+		if r.ErrKind != "" {
+			fmt.Fprintf(out, "❌ %s [%s]: %s\n", r.Domain, r.ErrKind, r.Error)
+		} else {
+			fmt.Fprintf(out, "❌ %s: %s\n", r.Domain, r.Error)
 		}
+		return
 	}
 
-	fmt.Println("\n所有IP已保存到host变量")
-	fmt.Printf("共提取到 %d 个有效IP\n", len(host))
+	fmt.Fprintf(out, "%s 提取到的IP地址：\n", r.Domain)
+	for i, ip := range r.IPs {
+		fmt.Fprintf(out, "%2d: %s\n", i+1, ip)
+	}
+	fmt.Fprintf(out, "共提取到 %d 个有效IP\n", len(r.IPs))
+	fmt.Fprintf(out, "✅ 最快IP: %s (平均延迟 %s)\n", r.IP, formatLatency(r.Latency))
 }
 
-// 更新hosts文件
-func updateHosts(ipMap map[string]string) error {
-	// 根据操作系统确定hosts文件路径
-	var hostsPath string
+// root写入仍然被拒绝，多半是文件设置了不可修改属性，给出清除的方法。
+// Android的 /system 默认只读挂载，给出重新挂载的命令，但不自动执行
+func immutableHint(path string, err error) error {
+	if runtime.GOOS == "android" && errors.Is(err, syscall.EROFS) {
+		return fmt.Errorf("%w\n💡 %s 所在的分区以只读方式挂载，需要root后重新挂载为可写: su -c 'mount -o rw,remount /system' (system-as-root的设备为 su -c 'mount -o rw,remount /')", err, path)
+	}
+	if !errors.Is(err, fs.ErrPermission) || os.Geteuid() != 0 {
+		return err
+	}
+	switch runtime.GOOS {
+	case "linux":
+		return fmt.Errorf("%w\n💡 以root身份仍无法写入，%s 可能设置了不可修改属性 (chattr +i)，可用 lsattr %s 查看，sudo chattr -i %s 清除", err, path, path, path)
+	case "darwin":
+		return fmt.Errorf("%w\n💡 以root身份仍无法写入，%s 可能设置了不可修改标志，可用 ls -lO %s 查看，sudo chflags noschg,nouchg %s 清除", err, path, path, path)
+	}
+	return err
+}
+
+// 根据操作系统确定hosts文件路径，指定 -container 时为容器的hosts文件
+func hostsFilePath() (string, error) {
+	if *container != "" {
+		return containerHostsPath()
+	}
 	switch runtime.GOOS {
 	case "windows":
-		hostsPath = `C:\Windows\System32\drivers\etc\hosts`
+		return `C:\Windows\System32\drivers\etc\hosts`, nil
 	case "linux", "darwin": // darwin是macOS
-		hostsPath = "/etc/hosts"
+		return "/etc/hosts", nil
+	case "android": // 需要root，如在Termux中运行
+		return "/system/etc/hosts", nil
 	default:
-		return fmt.Errorf("不支持的操作系统: %s", runtime.GOOS)
+		return "", fmt.Errorf("不支持的操作系统: %s", runtime.GOOS)
 	}
+}
 
-	// 读取现有hosts文件
-	file, err := os.Open(hostsPath)
+// 更新hosts文件，返回每个域名条目的变化和写入后的管理区块
+func updateHosts(ipMap map[string][]string, backup *sync.Once) (map[string]string, []string, error) {
+	hostsPath, err := hostsFilePath()
 	if err != nil {
-		return err
+		return nil, nil, err
+	}
+	lines, err := readHostsLines(hostsPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	newLines, actions := rewriteHosts(lines, ipMap)
+	// 只有区块起始行中的生成时间不同时不备份也不写入，
+	// 否则每次运行都会产生一份备份，把修改前真正有用的备份轮换掉
+	if sameIgnoringHeader(lines, newLines) {
+		return actions, managedBlock(lines), nil
+	}
+	// 分批写入时只在第一次修改前备份，保留的是运行前的hosts
+	backup.Do(func() {
+		if err := backupHosts(hostsPath, changeNote(actions)); err != nil {
+			fmt.Fprintf(out, "⚠️ 备份hosts失败: %v\n", err)
+		}
+	})
+	return actions, managedBlock(newLines), writeHostsLines(hostsPath, newLines)
+}
+
+// 比较hosts内容，忽略区块起始行附带的版本号和生成时间
+func sameIgnoringHeader(a, b []string) bool {
+	return slices.EqualFunc(a, b, func(x, y string) bool {
+		return x == y || isMarker(x, blockBegin()) && isMarker(y, blockBegin())
+	})
+}
+
+// 逐行读取hosts文件
+func readHostsLines(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
 	}
 	defer file.Close()
 
+	var lines []string
+	scanner := hostsScanner(file)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines, scanner.Err()
+}
+
+// 写入hosts文件，每行以换行结尾
+func writeHostsLines(path string, lines []string) error {
+	output, err := os.Create(path)
+	if err != nil {
+		return immutableHint(path, err)
+	}
+	defer output.Close()
+
+	writer := bufio.NewWriter(output)
+	for _, line := range lines {
+		fmt.Fprintln(writer, line)
+	}
+	return writer.Flush()
+}
+
+// 管理区块的起止标记，名称由 -section-name 指定
+func blockBegin() string { return "# " + *sectionName + "-begin" }
+func blockEnd() string   { return "# " + *sectionName + "-end" }
+
+// 区块的起始行，附带版本号和生成时间(UTC)。
+// -stable-comments 时省略生成时间，IP不变时重写的内容与之前完全相同
+func blockHeader() string {
+	if *stableComments {
+		return blockBegin() + " " + version
+	}
+	return fmt.Sprintf("%s %s %s", blockBegin(), version, time.Now().UTC().Format(time.RFC3339))
+}
+
+// 判断一行是否为指定的标记，标记后可以附带其他信息
+func isMarker(line, marker string) bool {
+	return line == marker || strings.HasPrefix(line, marker+" ")
+}
+
+// hosts中域名条目的变化
+const (
+	actionAdded     = "added"
+	actionUpdated   = "updated"
+	actionUnchanged = "unchanged"
+	actionManual    = "manual"  // 区块外有手动条目，未修改
+	actionKept      = "kept"    // 没有合适的IP，保留原有条目 (-on-no-candidate keep)
+	actionRemoved   = "removed" // 没有合适的IP，已从区块删除 (-on-no-candidate remove)
+)
+
+// 取出hosts内容中的管理区块，包括首尾标记
+func managedBlock(lines []string) []string {
+	start := slices.IndexFunc(lines, func(l string) bool { return isMarker(l, blockBegin()) })
+	if start < 0 {
+		return nil
+	}
+	end := slices.IndexFunc(lines[start:], func(l string) bool { return isMarker(l, blockEnd()) })
+	if end < 0 {
+		return slices.Clone(lines[start:])
+	}
+	return slices.Clone(lines[start : start+end+1])
+}
+
+// 解析管理区块中的条目，返回每个域名按出现顺序的IP
+func blockEntries(block []string) map[string][]string {
+	entries := make(map[string][]string)
+	for _, line := range block {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		for _, domain := range fields[1:] {
+			if !slices.Contains(entries[domain], fields[0]) {
+				entries[domain] = append(entries[domain], fields[0])
+			}
+		}
+	}
+	return entries
+}
+
+// 在hosts内容中应用新的IP。区块外已有条目的域名视为手动维护而跳过，
+// 指定 -override-manual 时则原地更新；其余条目写入管理区块；存在多个区块时（例如旧版本遗留）合并为一个，
+// 放在第一个区块的位置，区块之间的其他内容保持不变。
+// ipMap中每个域名可以有多个IP，区块内按顺序各写一行，区块外只更新为第一个IP；
+// IP列表为空表示从区块中删除该域名，区块外的条目不受影响。
+// 区块内同一域名的条目整体替换；区块外有多行条目时按 -merge-strategy 处理。
+// 同时返回ipMap中每个域名条目的变化
+func rewriteHosts(lines []string, ipMap map[string][]string) ([]string, map[string]string) {
 	var newLines []string
-	scanner := bufio.NewScanner(file)
 	existingDomains := make(map[string]bool)
+	actions := make(map[string]string)
+	targets := mergeTargets(lines, ipMap)
+
+	// 区块内的条目，按出现顺序记录
+	var blockDomains []string
+	blockIPs := make(map[string][]string)
+	blockAt, blocks := -1, 0
+	inBlock := false
 
 	// 处理每一行
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
+	for n, line := range lines {
+		line = strings.TrimSpace(line)
+
+		// 识别区块标记，未闭合的区块一直延续到文件末尾
+		if isMarker(line, blockBegin()) {
+			if !inBlock {
+				inBlock = true
+				blocks++
+				if blockAt < 0 {
+					blockAt = len(newLines)
+				}
+			}
+			continue
+		}
+		if isMarker(line, blockEnd()) {
+			inBlock = false
+			continue
+		}
+
+		if inBlock {
+			fields := strings.Fields(line)
+			if len(fields) < 2 || strings.HasPrefix(line, "#") {
+				continue
+			}
+			for _, domain := range fields[1:] {
+				if _, seen := blockIPs[domain]; !seen {
+					blockDomains = append(blockDomains, domain)
+				}
+				if !slices.Contains(blockIPs[domain], fields[0]) {
+					blockIPs[domain] = append(blockIPs[domain], fields[0])
+				}
+			}
+			continue
+		}
+
 		// 保留注释行
 		if strings.HasPrefix(line, "#") {
 			newLines = append(newLines, line)
@@ -101,15 +1112,29 @@ func updateHosts(ipMap map[string]string) error {
 		updated := false
 		for i := 1; i < len(fields); i++ {
 			domain := fields[i]
-			if newIP, exists := ipMap[domain]; exists {
-				if fields[0] != newIP {
+			if newIPs, exists := ipMap[domain]; exists && len(newIPs) > 0 {
+				newIP := newIPs[0]
+				if *overrideManual && !targets[domain][n] {
+					// 冲突的条目中未被选中的一行，去掉该域名，没有其他域名时删除整行
+					fmt.Fprintf(out, "➖ 删除冲突条目: %s %s\n", fields[0], domain)
+					if rest := slices.Delete(fields, i, i+1); len(rest) > 1 {
+						newLines = append(newLines, strings.Join(rest, " "))
+					}
+				} else if !*overrideManual {
+					// 区块外的条目视为用户手动维护，不自动修改
+					fmt.Fprintf(out, "⚠️ %s 在%s区块外有手动条目，跳过（使用 -override-manual 覆盖）\n", domain, *sectionName)
+					newLines = append(newLines, line)
+					actions[domain] = actionManual
+				} else if fields[0] != newIP {
 					// 构建更新行
 					newLine := newIP + " " + strings.Join(fields[1:], " ")
 					newLines = append(newLines, newLine)
-					fmt.Printf("🔄 更新: %s -> %s\n", domain, newIP)
+					fmt.Fprintf(out, "🔄 更新: %s -> %s\n", domain, newIP)
+					actions[domain] = actionUpdated
 				} else {
-					fmt.Printf("✅ 无需更新: %s 已是最新\n", domain)
+					fmt.Fprintf(out, "✅ 无需更新: %s 已是最新\n", domain)
 					newLines = append(newLines, line)
+					actions[domain] = actionUnchanged
 				}
 				updated = true
 				existingDomains[domain] = true
@@ -122,56 +1147,165 @@ func updateHosts(ipMap map[string]string) error {
 		}
 	}
 
+	if blocks > 1 {
+		fmt.Fprintf(out, "🧹 合并了 %d 个%s区块\n", blocks, *sectionName)
+	}
+
+	// 更新区块内的条目
+	var block []string
+	for _, domain := range blockDomains {
+		if existingDomains[domain] {
+			continue
+		}
+		ips := blockIPs[domain]
+		if newIPs, exists := ipMap[domain]; exists {
+			existingDomains[domain] = true
+			if len(newIPs) == 0 {
+				fmt.Fprintf(out, "➖ 删除: %s\n", domain)
+				actions[domain] = actionRemoved
+				continue
+			}
+			if !slices.Equal(ips, newIPs) {
+				fmt.Fprintf(out, "🔄 更新: %s -> %s\n", domain, strings.Join(newIPs, ", "))
+				ips = newIPs
+				actions[domain] = actionUpdated
+			} else {
+				fmt.Fprintf(out, "✅ 无需更新: %s 已是最新\n", domain)
+				actions[domain] = actionUnchanged
+			}
+		}
+		for _, ip := range ips {
+			block = append(block, ip+" "+domain)
+		}
+	}
+
 	// 添加缺失的域名条目
-	for domain, ip := range ipMap {
-		if !existingDomains[domain] {
-			newLine := fmt.Sprintf("%s %s", ip, domain)
-			newLines = append(newLines, newLine)
-			fmt.Printf("➕ 新增: %s -> %s\n", domain, ip)
+	for _, domain := range slices.Sorted(maps.Keys(ipMap)) {
+		if ips := ipMap[domain]; !existingDomains[domain] && len(ips) > 0 {
+			for _, ip := range ips {
+				block = append(block, ip+" "+domain)
+			}
+			fmt.Fprintf(out, "➕ 新增: %s -> %s\n", domain, strings.Join(ips, ", "))
+			actions[domain] = actionAdded
 		}
 	}
 
-	// 写入更新后的hosts文件
-	output, err := os.Create(hostsPath)
-	if err != nil {
-		return err
+	if len(block) == 0 {
+		return newLines, actions
 	}
-	defer output.Close()
+	block = append([]string{blockHeader()}, append(block, blockEnd())...)
+	if blockAt < 0 {
+		// 还没有区块时按 -block-position 放在文件开头或末尾
+		if *blockPosition == "top" {
+			return append(block, newLines...), actions
+		}
+		return append(newLines, block...), actions
+	}
+	return slices.Insert(newLines, blockAt, block...), actions
+}
 
-	writer := bufio.NewWriter(output)
-	for _, line := range newLines {
-		fmt.Fprintln(writer, line)
+// 区块外的条目中，-override-manual 时需要更新的行（按行号）。
+// 同一域名在区块外有多行条目时：replace-all 全部更新，first-wins 只更新第一行，
+// last-wins 只更新最后一行，其余行中去掉该域名。
+// 不覆盖手动条目时只提示冲突，系统只会使用第一行
+func mergeTargets(lines []string, ipMap map[string][]string) map[string]map[int]bool {
+	rows := make(map[string][]int)
+	ips := make(map[string][]string)
+	inBlock := false
+	for n, line := range lines {
+		line = strings.TrimSpace(line)
+		switch {
+		case isMarker(line, blockBegin()):
+			inBlock = true
+			continue
+		case isMarker(line, blockEnd()):
+			inBlock = false
+			continue
+		}
+		fields := strings.Fields(line)
+		if inBlock || len(fields) < 2 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		for _, domain := range fields[1:] {
+			if len(ipMap[domain]) > 0 {
+				rows[domain] = append(rows[domain], n)
+				if !slices.Contains(ips[domain], fields[0]) {
+					ips[domain] = append(ips[domain], fields[0])
+				}
+			}
+		}
 	}
-	writer.Flush()
 
-	return nil
+	targets := make(map[string]map[int]bool)
+	for domain, ns := range rows {
+		if len(ips[domain]) > 1 && !*overrideManual {
+			fmt.Fprintf(out, "⚠️ %s 在%s区块外有 %d 个不同IP的条目 (%s)，系统只会使用第一个\n", domain, *sectionName, len(ips[domain]), strings.Join(ips[domain], ", "))
+		}
+		switch *mergeStrategy {
+		case "first-wins":
+			ns = ns[:1]
+		case "last-wins":
+			ns = ns[len(ns)-1:]
+		}
+		targets[domain] = make(map[int]bool, len(ns))
+		for _, n := range ns {
+			targets[domain][n] = true
+		}
+	}
+	return targets
 }
 
 // 刷新DNS缓存
 func flushDNS() {
-	fmt.Println("\n刷新DNS缓存...")
-	var cmd *exec.Cmd
-
-	switch runtime.GOOS {
-	case "windows":
-		cmd = exec.Command("ipconfig", "/flushdns")
-	case "darwin": // macOS
-		cmd = exec.Command("sudo", "killall", "-HUP", "mDNSResponder")
-	case "linux":
-		// 尝试不同的Linux刷新方法
-		if _, err := exec.LookPath("resolvectl"); err == nil {
-			cmd = exec.Command("sudo", "resolvectl", "flush-caches")
-		} else {
-			cmd = exec.Command("sudo", "systemd-resolve", "--flush-caches")
+	if *container != "" && *flushCmd == "" {
+		// 容器内一般没有DNS缓存服务，宿主机的缓存也与容器无关
+		fmt.Fprintln(out, "\n已写入容器的hosts，跳过刷新DNS缓存")
+		return
+	}
+	fmt.Fprintln(out, "\n刷新DNS缓存...")
+	err := runFlush(false)
+	if errors.Is(err, errNoDNSCache) {
+		fmt.Fprintf(out, "ℹ️ %v\n", err)
+		return
+	}
+	if err != nil && isPermissionError(err) {
+		fmt.Fprintf(out, "⚠️ 刷新DNS失败: 权限不足\n💡 %s\n", privilegeHint())
+		// 在终端中运行时可以重试一次，sudo会直接在终端中询问密码
+		if !canPrompt() || !confirm("是否重试? [y/N]: ") {
+			return
+		}
+		err = runFlush(true)
+	}
+	if err != nil {
+		fmt.Fprintf(out, "⚠️ 刷新DNS失败: %v\n", err)
+		if isPermissionError(err) {
+			fmt.Fprintf(out, "💡 %s\n", privilegeHint())
 		}
-	default:
-		fmt.Println("⚠️ 不支持的操作系统，请手动刷新DNS")
 		return
 	}
+	fmt.Fprintln(out, "✅ DNS缓存刷新完成")
+}
 
-	if err := cmd.Run(); err != nil {
-		fmt.Printf("⚠️ 刷新DNS失败: %v (可能需要sudo权限)\n", err)
-	} else {
-		fmt.Println("✅ DNS缓存刷新完成")
+// 执行一次刷新。interactive为true时命令可以读取终端输入，如sudo询问密码
+func runFlush(interactive bool) error {
+	switch {
+	case *flushCmd != "":
+		// 用户指定的命令，完全跳过内置的检测逻辑
+		args := strings.Fields(*flushCmd)
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Stdout, cmd.Stderr = out, out
+		if interactive {
+			cmd.Stdin = os.Stdin
+		}
+		return cmd.Run()
+	case runtime.GOOS == "windows":
+		return runCommand(interactive, "ipconfig", "/flushdns")
+	case runtime.GOOS == "darwin": // macOS
+		return flushDNSCaches(interactive, darwinDNSCaches())
+	case runtime.GOOS == "linux":
+		// Linux上可能同时存在多种DNS缓存，逐一刷新
+		return flushDNSCaches(interactive, linuxDNSCaches())
+	default:
+		return errors.New("不支持的操作系统，请手动刷新DNS")
 	}
 }
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 排在前面的域名返回得更慢，并发时完成顺序与输入顺序相反
+type slowProvider struct {
+	domains []string
+	mu      sync.Mutex
+	order   []string
+}
+
+func (p *slowProvider) Probe(ctx context.Context, domain string) ([]string, []PingResult, error) {
+	i := slices.Index(p.domains, domain)
+	select {
+	case <-time.After(time.Duration(len(p.domains)-i) * 20 * time.Millisecond):
+	case <-ctx.Done():
+		return nil, nil, ctx.Err()
+	}
+	p.mu.Lock()
+	p.order = append(p.order, domain)
+	p.mu.Unlock()
+	ip := fmt.Sprintf("1.0.0.%d", i+1)
+	return []string{ip}, []PingResult{{Node: "北京电信", IP: ip, Time: float64(10 + i)}}, nil
+}
+
+// 并发探测时结果仍按输入顺序输出
+func TestRunKeepsInputOrder(t *testing.T) {
+	dir := t.TempDir()
+	domains := []string{"a.com", "b.com", "c.com", "d.com", "e.com"}
+	batch := filepath.Join(dir, "domains.txt")
+	if err := os.WriteFile(batch, []byte(strings.Join(domains, "\n")+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	report := filepath.Join(dir, "report.json")
+	setFlag(t, &out, io.Discard)
+	setFlag(t, providerName, "mock")
+	setFlag(t, dryRun, true)
+	setFlag(t, batchFile, batch)
+	setFlag(t, stateFile, filepath.Join(dir, "state.jsonl"))
+	setFlag(t, concurrency, len(domains))
+	setFlag(t, reportFile, report)
+	setFlag(t, jsonOut, true)
+	setFlag(t, &jsonPrinted, false)
+
+	provider := &slowProvider{domains: domains}
+	stdout := captureStdout(t, func() {
+		if err := run(context.Background(), provider); err != nil {
+			t.Error(err)
+		}
+	})
+	if slices.Equal(provider.order, domains) {
+		t.Fatalf("探测按输入顺序完成 %v，没有覆盖并发的情况", provider.order)
+	}
+
+	data, err := os.ReadFile(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 标准输出的 -json 结果和 -report-file 都按输入顺序
+	for name, data := range map[string][]byte{"-json": stdout, "-report-file": data} {
+		var results []Result
+		if err := json.Unmarshal(data, &results); err != nil {
+			t.Fatalf("%s: %v\n%s", name, err, data)
+		}
+		var got []string
+		for i, r := range results {
+			got = append(got, r.Domain)
+			if want := fmt.Sprintf("1.0.0.%d", i+1); r.IP != want {
+				t.Errorf("%s: %s 的IP = %s, want %s", name, r.Domain, r.IP, want)
+			}
+		}
+		if !slices.Equal(got, domains) {
+			t.Errorf("%s: 结果顺序 = %v, want %v", name, got, domains)
+		}
+	}
+}
+
+// 执行f并返回其间写到标准输出的内容
+func captureStdout(t *testing.T, f func()) []byte {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := os.Stdout
+	os.Stdout = w
+	done := make(chan []byte)
+	go func() {
+		data, _ := io.ReadAll(r)
+		done <- data
+	}()
+	f()
+	os.Stdout = old
+	w.Close()
+	return <-done
+}
@@ -2,7 +2,11 @@ module fastip
 
 go 1.25rc1
 
-require github.com/chromedp/chromedp v0.13.7
+require (
+	github.com/BurntSushi/toml v1.6.0
+	github.com/chromedp/chromedp v0.13.7
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require (
 	github.com/chromedp/cdproto v0.0.0-20250621212827-3f1355e655b9 // indirect
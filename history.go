@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// 历史记录中的一条，每次运行每个成功的域名一条
+type historyRecord struct {
+	Time    time.Time `json:"time"`
+	Domain  string    `json:"domain"`
+	IP      string    `json:"ip"`
+	Latency float64   `json:"latency_ms"`
+}
+
+// 把本次成功的结果追加到历史记录
+func appendHistory(path string, results []Result) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	now := time.Now().UTC()
+	enc := json.NewEncoder(file)
+	for _, r := range results {
+		if r.Error != "" {
+			continue
+		}
+		if err := enc.Encode(historyRecord{Time: now, Domain: r.Domain, IP: r.IP, Latency: r.Latency}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 读取指定时间之后的历史记录，无法解析的行被忽略
+func readHistory(path string, since time.Time) ([]historyRecord, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var records []historyRecord
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var rec historyRecord
+		if json.Unmarshal(scanner.Bytes(), &rec) != nil {
+			continue
+		}
+		if !rec.Time.Before(since) {
+			records = append(records, rec)
+		}
+	}
+	return records, scanner.Err()
+}
+
+// 单个域名在时间窗口内的汇总
+type historySummary struct {
+	Domain string         `json:"domain"`
+	Runs   int            `json:"runs"`
+	IPs    map[string]int `json:"ips"` // 每个IP被选中的次数
+	Min    float64        `json:"min"`
+	Avg    float64        `json:"avg"`
+	Max    float64        `json:"max"`
+	First  float64        `json:"first"` // 窗口内第一次的延迟
+	Last   float64        `json:"last"`  // 窗口内最后一次的延迟
+	Unit   string         `json:"latency_unit"`
+}
+
+// 按域名汇总历史记录
+func summarizeHistory(records []historyRecord) []historySummary {
+	byDomain := make(map[string][]historyRecord)
+	for _, rec := range records {
+		byDomain[rec.Domain] = append(byDomain[rec.Domain], rec)
+	}
+
+	var summaries []historySummary
+	for _, domain := range slices.Sorted(maps.Keys(byDomain)) {
+		recs := byDomain[domain]
+		slices.SortStableFunc(recs, func(a, b historyRecord) int { return a.Time.Compare(b.Time) })
+
+		s := historySummary{Domain: domain, Runs: len(recs), IPs: make(map[string]int), Unit: *latencyUnit}
+		lo, hi, sum := recs[0].Latency, recs[0].Latency, 0.0
+		for _, rec := range recs {
+			s.IPs[rec.IP]++
+			lo, hi = min(lo, rec.Latency), max(hi, rec.Latency)
+			sum += rec.Latency
+		}
+		s.Min, s.Max = latencyIn(lo), latencyIn(hi)
+		s.Avg = latencyIn(sum / float64(len(recs)))
+		s.First, s.Last = latencyIn(recs[0].Latency), latencyIn(recs[len(recs)-1].Latency)
+		summaries = append(summaries, s)
+	}
+	return summaries
+}
+
+// fastip history 子命令：汇总一段时间内选中的IP和延迟变化
+func historyCmd(args []string) error {
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	since := fs.Duration("since", 24*time.Hour, "只统计最近这段时间内的记录")
+	asJSON := fs.Bool("json", false, "以JSON输出")
+	fs.StringVar(historyFile, "history", *historyFile, "历史记录文件")
+	fs.StringVar(latencyUnit, "latency-unit", *latencyUnit, "输出延迟的单位: ms|s")
+	fs.Parse(args)
+	if err := validateLatencyUnit(); err != nil {
+		return err
+	}
+
+	records, err := readHistory(*historyFile, time.Now().Add(-*since))
+	if err != nil {
+		return err
+	}
+	summaries := summarizeHistory(records)
+
+	if *asJSON {
+		data, err := json.Marshal(summaries)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	if len(summaries) == 0 {
+		fmt.Printf("最近 %s 内没有记录\n", *since)
+		return nil
+	}
+	fmt.Printf("最近 %s 内的记录：\n", *since)
+	for _, s := range summaries {
+		var ips []string
+		for _, ip := range slices.Sorted(maps.Keys(s.IPs)) {
+			ips = append(ips, fmt.Sprintf("%s(%d)", ip, s.IPs[ip]))
+		}
+		fmt.Printf("%s  运行 %d 次  IP: %s\n", s.Domain, s.Runs, strings.Join(ips, " "))
+		fmt.Printf("  延迟 最小 %.2f%s / 平均 %.2f%s / 最大 %.2f%s  趋势 %.2f%s -> %.2f%s\n",
+			s.Min, s.Unit, s.Avg, s.Unit, s.Max, s.Unit, s.First, s.Unit, s.Last, s.Unit)
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// -output-hosts-only：生成独立的hosts片段（带区块标记的管理条目），path为 - 时输出到标准输出。
+// 条目按域名排序，同一域名重复的IP只写一次，内容只取决于结果，适合提交到仓库或分发；
+// 配合 -stable-comments 时区块标记中不带时间
+func writeHostsFragment(path string, ipMap map[string][]string) error {
+	lines := []string{blockHeader()}
+	for _, domain := range slices.Sorted(maps.Keys(ipMap)) {
+		var seen []string
+		for _, ip := range ipMap[domain] {
+			if !slices.Contains(seen, ip) {
+				seen = append(seen, ip)
+				lines = append(lines, ip+" "+domain)
+			}
+		}
+	}
+	lines = append(lines, blockEnd())
+	data := strings.Join(lines, "\n") + "\n"
+
+	if path == "-" {
+		_, err := os.Stdout.WriteString(data)
+		return err
+	}
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "📄 已生成hosts片段: %s\n", path)
+	return nil
+}
+
+// hosts中单行的长度上限。有些工具会把整份拦截列表写成一行，
+// bufio.Scanner默认64KB的上限会导致读取失败
+const maxHostsLine = 64 << 20
+
+// 逐行读取hosts的Scanner，允许很长的行
+func hostsScanner(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxHostsLine)
+	return scanner
+}
+
+// 解析hosts内容中的 域名->IP 映射。忽略空行和注释（包括行尾注释），
+// 一行可以有多个域名；与系统解析一致，同一域名以第一次出现的条目为准，
+// 但管理区块中的条目优先于区块外的条目
+func parseHosts(r io.Reader) (map[string]string, error) {
+	entries := make(map[string]string)
+	managed := make(map[string]bool)
+	inBlock := false
+	scanner := hostsScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case isMarker(line, blockBegin()):
+			inBlock = true
+			continue
+		case isMarker(line, blockEnd()):
+			inBlock = false
+			continue
+		}
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		for _, domain := range fields[1:] {
+			if _, ok := entries[domain]; ok && (managed[domain] || !inBlock) {
+				continue
+			}
+			entries[domain] = fields[0]
+			managed[domain] = inBlock
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// 累积已完成域名的IP，按 -flush-every 分批写入hosts，
+// 避免长时间运行中途崩溃时丢失全部结果
+type hostsWriter struct {
+	mu      sync.Mutex
+	every   int
+	ipMap   map[string][]string
+	pending int
+	written bool              // 是否成功写入过hosts
+	actions map[string]string // 每个域名条目的变化
+	block   []string          // 最近一次写入的管理区块
+	backup  sync.Once         // 每次运行只备份一次
+}
+
+func newHostsWriter(every int) *hostsWriter {
+	return &hostsWriter{every: every, ipMap: make(map[string][]string), actions: make(map[string]string)}
+}
+
+// 记录一个域名的结果，累计满N个时写入hosts
+func (w *hostsWriter) Add(domain string, ips []string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.ipMap[domain] = ips
+	w.pending++
+	if w.every > 0 && w.pending >= w.every {
+		w.write()
+	}
+}
+
+// 已累积的全部结果
+func (w *hostsWriter) snapshot() map[string][]string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return maps.Clone(w.ipMap)
+}
+
+// 写入尚未写入的结果
+func (w *hostsWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.pending > 0 {
+		w.write()
+	}
+}
+
+// 每次都写入全部已累积的结果，区块重写是幂等的，不会产生重复条目
+func (w *hostsWriter) write() {
+	w.pending = 0
+	if *dryRun || *compareTo != "" {
+		return
+	}
+
+	printMu.Lock()
+	defer printMu.Unlock()
+	start := time.Now()
+	actions, block, err := updateHosts(maps.Clone(w.ipMap), &w.backup)
+	timer.since(phaseWrite, start)
+	if err != nil {
+		fmt.Fprintf(out, "⚠️ 更新hosts失败: %v (可能需要管理员权限)\n", err)
+		return
+	}
+	w.written = true
+	w.block = block
+
+	// 分批写入时之前已更新的条目会被再次判定为无需更新，保留首次的变化
+	for domain, action := range actions {
+		if prev, ok := w.actions[domain]; !ok || prev == actionUnchanged {
+			w.actions[domain] = action
+		}
+	}
+}
+
+// 已写入的结果中是否有条目被新增、更新或删除，没有变化时无需刷新DNS
+func (w *hostsWriter) changed() bool {
+	for _, action := range w.actions {
+		switch action {
+		case actionAdded, actionUpdated, actionRemoved:
+			return true
+		}
+	}
+	return false
+}
+
+// 生成只包含管理区块的hosts内容，域名按字母顺序排列
+func renderBlock(ipMap map[string][]string) []string {
+	lines := []string{blockHeader()}
+	for _, domain := range slices.Sorted(maps.Keys(ipMap)) {
+		for _, ip := range ipMap[domain] {
+			lines = append(lines, ip+" "+domain)
+		}
+	}
+	return append(lines, blockEnd())
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// 测试期间修改flag，结束后恢复
+func setFlag[T any](t *testing.T, p *T, v T) {
+	t.Helper()
+	old := *p
+	*p = v
+	t.Cleanup(func() { *p = old })
+}
+
+// 固定区块起始行并丢弃输出，便于比较重写后的内容
+func quietHosts(t *testing.T) {
+	t.Helper()
+	setFlag(t, &out, io.Discard)
+	setFlag(t, stableComments, true)
+}
+
+func TestRewriteHosts(t *testing.T) {
+	quietHosts(t)
+	header := blockHeader()
+	tests := []struct {
+		name        string
+		lines       []string
+		ipMap       map[string][]string
+		want        []string
+		wantActions map[string]string
+	}{
+		{
+			name: "合并两个区块，区块之间的内容保持原位",
+			lines: []string{
+				"127.0.0.1 localhost",
+				"# fastip-begin v0.1 2024-01-01T00:00:00Z",
+				"1.1.1.1 a.com",
+				"# fastip-end",
+				"10.0.0.1 intranet",
+				"# fastip-begin",
+				"2.2.2.2 b.com",
+				"# fastip-end",
+			},
+			ipMap: map[string][]string{"a.com": {"3.3.3.3"}},
+			want: []string{
+				"127.0.0.1 localhost",
+				header,
+				"3.3.3.3 a.com",
+				"2.2.2.2 b.com",
+				"# fastip-end",
+				"10.0.0.1 intranet",
+			},
+			wantActions: map[string]string{"a.com": actionUpdated},
+		},
+		{
+			name:        "新增条目",
+			lines:       []string{"127.0.0.1 localhost"},
+			ipMap:       map[string][]string{"b.com": {"2.2.2.2"}, "a.com": {"1.1.1.1", "1.1.1.2"}},
+			want:        []string{"127.0.0.1 localhost", header, "1.1.1.1 a.com", "1.1.1.2 a.com", "2.2.2.2 b.com", "# fastip-end"},
+			wantActions: map[string]string{"a.com": actionAdded, "b.com": actionAdded},
+		},
+		{
+			name:        "-dual-write 之后只剩IPv4时删除IPv6条目",
+			lines:       []string{header, "1.1.1.1 a.com", "2001:db8::1 a.com", "# fastip-end"},
+			ipMap:       map[string][]string{"a.com": {"1.1.1.1"}},
+			want:        []string{header, "1.1.1.1 a.com", "# fastip-end"},
+			wantActions: map[string]string{"a.com": actionUpdated},
+		},
+		{
+			name:        "IP列表为空时从区块删除",
+			lines:       []string{header, "1.1.1.1 a.com", "2.2.2.2 b.com", "# fastip-end"},
+			ipMap:       map[string][]string{"a.com": nil},
+			want:        []string{header, "2.2.2.2 b.com", "# fastip-end"},
+			wantActions: map[string]string{"a.com": actionRemoved},
+		},
+		{
+			name:        "区块外的手动条目不修改",
+			lines:       []string{"5.5.5.5 a.com"},
+			ipMap:       map[string][]string{"a.com": {"1.1.1.1"}},
+			want:        []string{"5.5.5.5 a.com"},
+			wantActions: map[string]string{"a.com": actionManual},
+		},
+		{
+			name:        "未闭合的区块延续到文件末尾",
+			lines:       []string{"127.0.0.1 localhost", "# fastip-begin", "1.1.1.1 a.com"},
+			ipMap:       map[string][]string{"a.com": {"1.1.1.1"}},
+			want:        []string{"127.0.0.1 localhost", header, "1.1.1.1 a.com", "# fastip-end"},
+			wantActions: map[string]string{"a.com": actionUnchanged},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, actions := rewriteHosts(tt.lines, tt.ipMap)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("rewriteHosts() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+			if !maps.Equal(actions, tt.wantActions) {
+				t.Errorf("actions = %v, want %v", actions, tt.wantActions)
+			}
+		})
+	}
+}
+
+// -flush-every 分批写入时每次都重写全部已累积的结果，不能产生重复条目
+func TestRewriteHostsIdempotent(t *testing.T) {
+	quietHosts(t)
+	lines := []string{"127.0.0.1 localhost"}
+	first, _ := rewriteHosts(lines, map[string][]string{"a.com": {"1.1.1.1"}})
+	ipMap := map[string][]string{"a.com": {"1.1.1.1"}, "b.com": {"2.2.2.2"}}
+	second, _ := rewriteHosts(first, ipMap)
+	third, actions := rewriteHosts(second, ipMap)
+	if !slices.Equal(second, third) {
+		t.Errorf("重复写入改变了内容:\n%s\n->\n%s", strings.Join(second, "\n"), strings.Join(third, "\n"))
+	}
+	if got := len(blockEntries(managedBlock(third))["a.com"]); got != 1 {
+		t.Errorf("a.com 有 %d 个条目, want 1", got)
+	}
+	for domain, action := range actions {
+		if action != actionUnchanged {
+			t.Errorf("%s: action = %s, want %s", domain, action, actionUnchanged)
+		}
+	}
+}
+
+func TestRewriteHostsBlockPosition(t *testing.T) {
+	quietHosts(t)
+	header := blockHeader()
+	lines := []string{"127.0.0.1 localhost", "::1 localhost"}
+	ipMap := map[string][]string{"a.com": {"1.1.1.1"}}
+	tests := []struct {
+		position string
+		lines    []string
+		want     []string
+	}{
+		{"top", lines, []string{header, "1.1.1.1 a.com", "# fastip-end", "127.0.0.1 localhost", "::1 localhost"}},
+		{"bottom", lines, []string{"127.0.0.1 localhost", "::1 localhost", header, "1.1.1.1 a.com", "# fastip-end"}},
+		// 已有的区块保持原位
+		{
+			"top",
+			[]string{"127.0.0.1 localhost", header, "2.2.2.2 a.com", "# fastip-end", "::1 localhost"},
+			[]string{"127.0.0.1 localhost", header, "1.1.1.1 a.com", "# fastip-end", "::1 localhost"},
+		},
+	}
+	for _, tt := range tests {
+		setFlag(t, blockPosition, tt.position)
+		got, _ := rewriteHosts(tt.lines, ipMap)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("-block-position %s:\n%s\nwant\n%s", tt.position, strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+		}
+	}
+}
+
+func TestRewriteHostsMergeStrategy(t *testing.T) {
+	quietHosts(t)
+	lines := []string{"1.1.1.1 a.com x.com", "# 注释", "2.2.2.2 a.com y.com"}
+	ipMap := map[string][]string{"a.com": {"9.9.9.9"}}
+	tests := []struct {
+		strategy string
+		override bool
+		want     []string
+	}{
+		{"replace-all", true, []string{"9.9.9.9 a.com x.com", "# 注释", "9.9.9.9 a.com y.com"}},
+		{"first-wins", true, []string{"9.9.9.9 a.com x.com", "# 注释", "2.2.2.2 y.com"}},
+		{"last-wins", true, []string{"1.1.1.1 x.com", "# 注释", "9.9.9.9 a.com y.com"}},
+		{"replace-all", false, lines},
+	}
+	for _, tt := range tests {
+		setFlag(t, mergeStrategy, tt.strategy)
+		setFlag(t, overrideManual, tt.override)
+		got, _ := rewriteHosts(lines, ipMap)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s (override %v):\n%s\nwant\n%s", tt.strategy, tt.override, strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+		}
+	}
+}
+
+func TestParseHosts(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    map[string]string
+	}{
+		{
+			name:    "注释、空行和一行多个域名",
+			content: "# 注释\n\n127.0.0.1 localhost\n1.1.1.1  a.com   b.com # 行尾注释\n#2.2.2.2 c.com\n",
+			want:    map[string]string{"localhost": "127.0.0.1", "a.com": "1.1.1.1", "b.com": "1.1.1.1"},
+		},
+		{
+			name:    "同一域名以第一次出现的为准",
+			content: "1.1.1.1 a.com\n2.2.2.2 a.com\n",
+			want:    map[string]string{"a.com": "1.1.1.1"},
+		},
+		{
+			name:    "管理区块中的条目优先",
+			content: "1.1.1.1 a.com\n# fastip-begin dev\n2.2.2.2 a.com\n3.3.3.3 a.com\n# fastip-end\n4.4.4.4 a.com\n",
+			want:    map[string]string{"a.com": "2.2.2.2"},
+		},
+		{
+			name:    "只有IP的行",
+			content: "1.1.1.1\n",
+			want:    map[string]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseHosts(strings.NewReader(tt.content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("parseHosts() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeHosts(t *testing.T) {
+	lines := []string{
+		"  127.0.0.1   localhost  ",
+		"",
+		"",
+		"# fastip-begin dev",
+		"2.2.2.2 b.com",
+		"1.1.1.1\ta.com",
+		"2.2.2.2 b.com",
+		"# fastip-end",
+		"10.0.0.1 intranet   # 内网",
+		"10.0.0.1 intranet # 内网",
+		"# fastip-begin",
+		"3.3.3.3 a.com",
+		"# fastip-end",
+		"",
+	}
+	want := []string{
+		"127.0.0.1 localhost",
+		"",
+		"# fastip-begin dev",
+		"1.1.1.1 a.com",
+		"3.3.3.3 a.com",
+		"2.2.2.2 b.com",
+		"# fastip-end",
+		"10.0.0.1 intranet # 内网",
+	}
+	got := normalizeHosts(lines)
+	if !slices.Equal(got, want) {
+		t.Errorf("normalizeHosts() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if again := normalizeHosts(got); !slices.Equal(again, got) {
+		t.Errorf("再次规范化改变了内容:\n%s", strings.Join(again, "\n"))
+	}
+}
+
+// 超过bufio.Scanner默认64KB上限的行也能读取
+func TestReadHostsLinesLongLine(t *testing.T) {
+	long := "0.0.0.0" + strings.Repeat(" blocked.example.com", 50000)
+	path := filepath.Join(t.TempDir(), "hosts")
+	if err := os.WriteFile(path, []byte("127.0.0.1 localhost\n"+long+"\n1.1.1.1 a.com\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	lines, err := readHostsLines(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 3 || lines[1] != long || lines[2] != "1.1.1.1 a.com" {
+		t.Errorf("读取到 %d 行", len(lines))
+	}
+	entries, err := parseHosts(strings.NewReader(strings.Join(lines, "\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries["a.com"] != "1.1.1.1" || entries["blocked.example.com"] != "0.0.0.0" {
+		t.Errorf("parseHosts() = a.com:%q blocked.example.com:%q", entries["a.com"], entries["blocked.example.com"])
+	}
+}
+
+// 只有区块起始行的生成时间不同时视为没有变化，不备份也不写入
+func TestSameIgnoringHeader(t *testing.T) {
+	tests := []struct {
+		a, b []string
+		want bool
+	}{
+		{
+			[]string{"# fastip-begin dev 2026-01-01T00:00:00Z", "1.1.1.1 a.com", "# fastip-end"},
+			[]string{"# fastip-begin dev 2026-10-15T10:00:00Z", "1.1.1.1 a.com", "# fastip-end"},
+			true,
+		},
+		{
+			[]string{"# fastip-begin dev 2026-01-01T00:00:00Z", "1.1.1.1 a.com", "# fastip-end"},
+			[]string{"# fastip-begin dev 2026-10-15T10:00:00Z", "2.2.2.2 a.com", "# fastip-end"},
+			false,
+		},
+		{
+			[]string{"127.0.0.1 localhost"},
+			[]string{"127.0.0.1 localhost", "# fastip-begin dev", "1.1.1.1 a.com", "# fastip-end"},
+			false,
+		},
+		{[]string{"# 注释"}, []string{"# fastip-begin"}, false},
+	}
+	for _, tt := range tests {
+		if got := sameIgnoringHeader(tt.a, tt.b); got != tt.want {
+			t.Errorf("sameIgnoringHeader(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
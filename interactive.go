@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var stdin = bufio.NewReader(os.Stdin)
+
+// 列出候选IP并让用户选择，直接回车接受自动选择的最快IP
+func chooseIP(r *Result) {
+	printMu.Lock()
+	defer printMu.Unlock()
+
+	fmt.Fprintf(out, "\n%s 的候选IP：\n", r.Domain)
+	for i, c := range r.Candidates {
+		fmt.Fprintf(out, "%2d: %-39s %s (%d个节点)\n", i+1, c.IP, formatLatency(c.Avg), c.Count)
+	}
+
+	for {
+		fmt.Fprintf(out, "选择IP [回车使用 %s]: ", r.IP)
+		line, err := stdin.ReadString('\n')
+		line = strings.TrimSpace(line)
+		if line == "" {
+			return
+		}
+
+		n, convErr := strconv.Atoi(line)
+		if convErr == nil && n >= 1 && n <= len(r.Candidates) {
+			c := r.Candidates[n-1]
+			r.IP, r.Latency = c.IP, c.Avg
+			if len(r.Top) > 0 {
+				// 选中的IP放到第一位
+				r.Top = append([]string{c.IP}, slices.DeleteFunc(r.Top, func(ip string) bool { return ip == c.IP })...)
+			}
+			return
+		}
+		if err != nil {
+			// 输入已结束，保留自动选择
+			return
+		}
+		fmt.Fprintf(out, "⚠️ 请输入 1-%d 之间的序号\n", len(r.Candidates))
+	}
+}
+
+// 询问是/否，只有输入y或yes才返回true
+func confirm(prompt string) bool {
+	fmt.Fprint(out, prompt)
+	line, _ := stdin.ReadString('\n')
+	answer := strings.ToLower(strings.TrimSpace(line))
+	return answer == "y" || answer == "yes"
+}
+
+// 能否向用户提问：标准输入是终端，且提示不会被 -quiet-json 丢弃
+func canPrompt() bool {
+	return isTerminal(os.Stdin) && !*quietJSON
+}
@@ -0,0 +1,503 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"maps"
+	"math"
+	"math/rand/v2"
+	"net"
+	"net/netip"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/chromedp/chromedp"
+)
+
+var (
+	ErrNoDomesticIP    = errors.New("未找到低延迟的国内IP")
+	ErrAllTimeout      = errors.New("所有节点超时，该域名可能已被完全屏蔽")
+	ErrRegionsFiltered = errors.New("所有节点都被 -regions 过滤掉了，请检查地区名称是否与itdog的节点名称一致")
+)
+
+// 读取检测结果表格，列依次为：检测点、响应IP、IP归属地、响应时间
+const pingTableJS = `Array.from(document.querySelectorAll('#simpletable tbody tr')).map(tr => {
+	const td = tr.querySelectorAll('td');
+	const text = i => td[i] ? td[i].innerText.trim() : '';
+	return {node: text(0), ip: text(1), location: text(2), time: text(3)};
+})`
+
+// 在新标签页中打开itdog的ping页面，执行单次测试并读取结果
+func queryItdog(browser context.Context, domain string) (string, []pingRow, error) {
+	ctx, cancel := chromedp.NewContext(browser)
+	defer cancel()
+
+	var (
+		ips  string
+		rows []pingRow
+	)
+	err := chromedp.Run(ctx,
+		chromedp.Navigate(itdogURL("ping", domain)),
+		chromedp.Click(`//button[contains(text(),'单次测试')]`, chromedp.NodeVisible),
+		chromedp.WaitVisible(`a.copy_ip`),
+		chromedp.AttributeValue(`a.copy_ip`, "copy-text", &ips, nil),
+		evaluateRows(pingTableJS, &rows),
+	)
+	return ips, rows, err
+}
+
+// 读取HTTP测试的结果表格。各列的位置按表头查找，响应时间优先取首包时间(TTFB)，
+// 没有该列时取总时间；HTTP状态不是2xx/3xx的行视为超时
+const httpTableJS = `(() => {
+	const heads = Array.from(document.querySelectorAll('#simpletable thead th')).map(th => th.innerText.trim());
+	const col = (...names) => heads.findIndex(h => names.some(n => h.includes(n)));
+	const ip = col('响应IP', 'IP地址'), loc = col('归属地'), status = col('状态');
+	let time = col('首包', '首字节');
+	if (time < 0) time = col('总时间', '总耗时');
+	return Array.from(document.querySelectorAll('#simpletable tbody tr')).map(tr => {
+		const td = tr.querySelectorAll('td');
+		const text = i => i >= 0 && td[i] ? td[i].innerText.trim() : '';
+		const ok = status < 0 || /^[23]\d\d/.test(text(status));
+		return {node: text(0), ip: text(ip), location: text(loc), time: ok ? text(time) : ''};
+	});
+})()`
+
+// 在新标签页中打开itdog的HTTP测试页面并读取结果。
+// 该页面没有IP列表，返回的IP文本为空，由调用方从表格中汇总
+func queryItdogHTTP(browser context.Context, domain string) (string, []pingRow, error) {
+	ctx, cancel := chromedp.NewContext(browser)
+	defer cancel()
+
+	var rows []pingRow
+	err := chromedp.Run(ctx,
+		chromedp.Navigate(itdogURL("http", domain)),
+		chromedp.Click(`//button[contains(text(),'单次测试') or contains(text(),'快速测试')]`, chromedp.NodeVisible),
+		chromedp.WaitVisible(`#simpletable tbody tr`),
+		evaluateRows(httpTableJS, &rows),
+	)
+	return "", rows, err
+}
+
+// itdog测试页面的地址，test为 ping 或 http。域名作为路径的一段需要转义
+func itdogURL(test, domain string) string {
+	return "https://www.itdog.cn/" + test + "/" + url.PathEscape(domain)
+}
+
+// -verbose 时输出的原始数据的最大长度
+const maxRawDump = 4096
+
+// 执行读取表格的脚本并解析结果。解析失败多半是itdog改版，
+// -verbose 时把原始数据输出到标准错误，便于反馈问题
+func evaluateRows(js string, rows *[]pingRow) chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		var raw []byte
+		if err := chromedp.Evaluate(js, &raw).Do(ctx); err != nil {
+			return err
+		}
+		if err := json.Unmarshal(raw, rows); err != nil {
+			if *verbose {
+				dump := raw
+				if len(dump) > maxRawDump {
+					dump = dump[:maxRawDump]
+				}
+				fmt.Fprintf(os.Stderr, "🔍 无法解析的原始数据 (共%d字节，显示前%d字节):\n%s\n", len(raw), len(dump), dump)
+			}
+			return fmt.Errorf("解析itdog结果失败: %w", err)
+		}
+		return nil
+	})
+}
+
+// 表格中的原始一行
+type pingRow struct {
+	Node     string `json:"node"`
+	IP       string `json:"ip"`
+	Location string `json:"location"`
+	Time     string `json:"time"`
+}
+
+// itdog单个检测节点的结果
+type PingResult struct {
+	Node     string  `json:"node"`
+	IP       string  `json:"ip"`
+	Location string  `json:"location,omitempty"` // IP归属地
+	Time     float64 `json:"time"`               // 响应时间(ms)
+	Timeout  bool    `json:"timeout,omitempty"`
+}
+
+// 解析表格行，无法识别的响应时间视为超时
+func parsePingRows(rows []pingRow) []PingResult {
+	results := make([]PingResult, 0, len(rows))
+	for _, row := range rows {
+		p := PingResult{Node: row.Node, IP: row.IP, Location: row.Location}
+		t, err := parseMillis(row.Time)
+		if err != nil {
+			p.Timeout = true
+		} else {
+			p.Time = t
+		}
+		results = append(results, p)
+	}
+	return results
+}
+
+// 解析响应时间，ping测试为 12ms，HTTP测试可能为 0.123s。
+// NaN、Inf 和负数也能被 ParseFloat 解析，但不是有效的响应时间，同样返回错误
+func parseMillis(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	scale := 1.0
+	if v, ok := strings.CutSuffix(s, "ms"); ok {
+		s = v
+	} else if v, ok := strings.CutSuffix(s, "s"); ok {
+		s, scale = v, 1000
+	}
+	t, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil {
+		return 0, err
+	}
+	if !validPingTime(t) {
+		return 0, fmt.Errorf("无效的响应时间 %q", s)
+	}
+	return t * scale, nil
+}
+
+// 响应时间是否为有限的非负数
+func validPingTime(t float64) bool {
+	return !math.IsNaN(t) && !math.IsInf(t, 0) && t >= 0
+}
+
+// 从未超时的节点中随机抽取k个，避免总是由同一批节点决定结果
+func sampleNodes(results []PingResult, k int, r *rand.Rand) []PingResult {
+	var ok []PingResult
+	for _, p := range results {
+		if !p.Timeout && p.IP != "" {
+			ok = append(ok, p)
+		}
+	}
+	if len(ok) <= k {
+		return ok
+	}
+	r.Shuffle(len(ok), func(i, j int) { ok[i], ok[j] = ok[j], ok[i] })
+	return ok[:k]
+}
+
+// 只保留平均响应时间最低的n个IP的结果，限制后续评分和本机验证的开销。
+// 全部超时的IP排在最后
+func limitCandidates(results []PingResult, n int) []PingResult {
+	sums := make(map[string]float64)
+	counts := make(map[string]int)
+	for _, p := range results {
+		if p.IP == "" {
+			continue
+		}
+		if _, ok := counts[p.IP]; !ok {
+			counts[p.IP] = 0
+		}
+		if !p.Timeout {
+			sums[p.IP] += p.Time
+			counts[p.IP]++
+		}
+	}
+	if len(counts) <= n {
+		return results
+	}
+
+	mean := func(ip string) float64 {
+		if counts[ip] == 0 {
+			return math.Inf(1)
+		}
+		return sums[ip] / float64(counts[ip])
+	}
+	ips := slices.SortedFunc(maps.Keys(counts), func(a, b string) int {
+		if c := cmp.Compare(mean(a), mean(b)); c != 0 {
+			return c
+		}
+		return strings.Compare(a, b)
+	})
+	keep := make(map[string]bool, n)
+	for _, ip := range ips[:n] {
+		keep[ip] = true
+	}
+	return slices.DeleteFunc(results, func(p PingResult) bool { return !keep[p.IP] })
+}
+
+// 抽样使用的随机源。指定 -seed 时按种子和域名确定，结果可复现且与并发顺序无关
+func nodeRand(domain string) *rand.Rand {
+	if *seed == 0 {
+		return rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
+	}
+	h := fnv.New64a()
+	h.Write([]byte(domain))
+	return rand.New(rand.NewPCG(uint64(*seed), h.Sum64()))
+}
+
+// 只保留指定运营商（如 电信、联通、移动）节点的结果，缓存的结果总是保留
+func filterISP(results []PingResult, isp string) []PingResult {
+	isp = canonicalISP(isp)
+	var filtered []PingResult
+	for _, p := range results {
+		if p.Node == cacheNode || nodeHasISP(p.Node, isp) {
+			filtered = append(filtered, p)
+		}
+	}
+	return filtered
+}
+
+// 只保留属于任一地区（如 北京、广东）的节点的结果，缓存的结果总是保留
+func filterRegions(results []PingResult, regions []string) []PingResult {
+	var filtered []PingResult
+	for _, p := range results {
+		if p.Node == cacheNode {
+			filtered = append(filtered, p)
+			continue
+		}
+		for _, region := range regions {
+			if region = strings.TrimSpace(region); region != "" && nodeInRegion(p.Node, canonicalRegion(region)) {
+				filtered = append(filtered, p)
+				break
+			}
+		}
+	}
+	return filtered
+}
+
+var (
+	ErrUnspecifiedIP   = errors.New("未指定地址")
+	ErrLoopbackIP      = errors.New("环回地址")
+	ErrPrivateIP       = errors.New("私有地址")
+	ErrLinkLocalIP     = errors.New("链路本地地址")
+	ErrMulticastIP     = errors.New("组播地址")
+	ErrDocumentationIP = errors.New("文档示例地址")
+	ErrInvalidIP       = errors.New("无效的IP地址")
+)
+
+// RFC 5737 和 RFC 3849 保留给文档示例的网段
+var documentationNets = []netip.Prefix{
+	netip.MustParsePrefix("192.0.2.0/24"),
+	netip.MustParsePrefix("198.51.100.0/24"),
+	netip.MustParsePrefix("203.0.113.0/24"),
+	netip.MustParsePrefix("2001:db8::/32"),
+}
+
+// 检查IP能否作为公网域名的候选IP，被DNS污染或劫持时常会返回这类地址，
+// 写入hosts只会让域名无法访问。-blocklist 中的IP同样不能作为候选
+func validCandidateIP(ip net.IP) error {
+	switch {
+	case ip == nil:
+		return ErrInvalidIP
+	case ip.IsUnspecified():
+		return ErrUnspecifiedIP
+	case ip.IsLoopback():
+		return ErrLoopbackIP
+	case ip.IsPrivate():
+		return ErrPrivateIP
+	case ip.IsLinkLocalUnicast(), ip.IsLinkLocalMulticast():
+		return ErrLinkLocalIP
+	case ip.IsMulticast():
+		return ErrMulticastIP
+	}
+	if addr, ok := netip.AddrFromSlice(ip); ok {
+		addr = addr.Unmap()
+		for _, p := range documentationNets {
+			if p.Contains(addr) {
+				return ErrDocumentationIP
+			}
+		}
+	}
+	if blocklisted(ip) {
+		return ErrBlocklistedIP
+	}
+	return nil
+}
+
+// 去掉不能作为候选的IP，并说明原因
+func dropInvalidIPs(domain string, results []PingResult) []PingResult {
+	rejected := make(map[string]bool)
+	return slices.DeleteFunc(results, func(p PingResult) bool {
+		if p.IP == "" {
+			return false
+		}
+		err := validCandidateIP(net.ParseIP(p.IP))
+		if err != nil && !rejected[p.IP] {
+			rejected[p.IP] = true
+			fmt.Fprintf(out, "🚫 %s: 忽略 %s (%v)\n", domain, p.IP, err)
+		}
+		return err != nil
+	})
+}
+
+// 合理的响应时间上限(ms)，超过的数据视为异常
+const maxPingTime = 10000
+
+// -strict-validation：汇总前检查每个节点的数据，去掉响应时间为负数、超出范围或不是数字，
+// 以及IP为空或无法解析的节点，并报告去掉的数量。超时的节点没有响应时间，只检查IP
+func validatePings(domain string, results []PingResult) []PingResult {
+	reasons := make(map[string]int)
+	valid := slices.DeleteFunc(slices.Clone(results), func(p PingResult) bool {
+		reason := ""
+		switch {
+		case p.IP == "":
+			reason = "IP为空"
+		case net.ParseIP(p.IP) == nil:
+			reason = "IP无效"
+		case p.Timeout:
+		case math.IsNaN(p.Time) || math.IsInf(p.Time, 0):
+			reason = "响应时间不是有效数字"
+		case p.Time < 0:
+			reason = "响应时间为负数"
+		case p.Time > maxPingTime:
+			reason = "响应时间超出范围"
+		}
+		if reason != "" {
+			reasons[reason]++
+		}
+		return reason != ""
+	})
+	if dropped := len(results) - len(valid); dropped > 0 {
+		var parts []string
+		for _, reason := range slices.Sorted(maps.Keys(reasons)) {
+			parts = append(parts, fmt.Sprintf("%s %d", reason, reasons[reason]))
+		}
+		fmt.Fprintf(out, "🧹 %s: 去掉 %d 个数据异常的节点 (%s)\n", domain, dropped, strings.Join(parts, ", "))
+	}
+	return valid
+}
+
+// 单个IP的汇总结果
+type IPStat struct {
+	IP       string  `json:"ip"`
+	Location string  `json:"location,omitempty"`
+	Avg      float64 `json:"avg"`    // 平均响应时间(ms)
+	Jitter   float64 `json:"jitter"` // 响应时间的标准差(ms)
+	Loss     float64 `json:"loss"`   // 超时节点的比例
+	Count    int     `json:"count"`  // 未超时的节点数
+}
+
+// 按IP汇总各节点的结果，按 -score-formula 的得分从低到高排序，
+// 默认只看平均延迟。只有超时记录的IP无法计算延迟，不参与排序
+func rankIPs(results []PingResult) []IPStat {
+	times := make(map[string][]float64)
+	timeouts := make(map[string]int)
+	locations := make(map[string]string)
+	for _, p := range results {
+		if p.IP == "" {
+			continue
+		}
+		// 模拟数据或回放的数据不经过 parseMillis，无效的响应时间同样视为超时，
+		// 否则排序时NaN和负数会排在最前面
+		if p.Timeout || !validPingTime(p.Time) {
+			timeouts[p.IP]++
+			continue
+		}
+		times[p.IP] = append(times[p.IP], p.Time)
+		if locations[p.IP] == "" {
+			locations[p.IP] = p.Location
+		}
+	}
+
+	stats := make([]IPStat, 0, len(times))
+	for ip, ts := range times {
+		n := float64(len(ts))
+		var sum, sq float64
+		for _, t := range ts {
+			sum += t
+		}
+		avg := sum / n
+		for _, t := range ts {
+			sq += (t - avg) * (t - avg)
+		}
+		stats = append(stats, IPStat{
+			IP:       ip,
+			Location: locations[ip],
+			Avg:      avg,
+			Jitter:   math.Sqrt(sq / n),
+			Loss:     float64(timeouts[ip]) / (n + float64(timeouts[ip])),
+			Count:    len(ts),
+		})
+	}
+
+	scores := scoreWeights.scores(stats)
+	idx := make(map[string]int, len(stats))
+	for i, s := range stats {
+		idx[s.IP] = i
+	}
+	slices.SortFunc(stats, func(a, b IPStat) int {
+		// -dials 多次连接时优先选择成功率高的IP，其次才比较评分
+		if *dials > 1 {
+			if c := cmp.Compare(a.Loss, b.Loss); c != 0 {
+				return c
+			}
+		}
+		if c := cmp.Compare(scores[idx[a.IP]], scores[idx[b.IP]]); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(a.Avg, b.Avg); c != 0 {
+			return c
+		}
+		return strings.Compare(a.IP, b.IP)
+	})
+	return stats
+}
+
+// 返回平均延迟最低的IP
+func findFastestIP(results []PingResult) (string, float64, error) {
+	stats := rankIPs(results)
+	if len(stats) == 0 {
+		if len(results) > 0 && !slices.ContainsFunc(results, func(p PingResult) bool { return !p.Timeout }) {
+			return "", 0, ErrAllTimeout
+		}
+		return "", 0, ErrNoDomesticIP
+	}
+	return stats[0].IP, stats[0].Avg, nil
+}
+
+// 取延迟最低的n个IP。指定region时，其中归属地包含region的IP排在前面，
+// 其余仍按延迟排序。部分系统的解析器会优先使用hosts中靠前的条目，
+// 所以顺序会影响实际连接的IP
+func pickTop(stats []IPStat, n int, region string) []IPStat {
+	top := slices.Clone(stats[:min(n, len(stats))])
+	if region != "" {
+		slices.SortStableFunc(top, func(a, b IPStat) int {
+			ar, br := strings.Contains(a.Location, region), strings.Contains(b.Location, region)
+			switch {
+			case ar && !br:
+				return -1
+			case br && !ar:
+				return 1
+			}
+			return 0
+		})
+	}
+	return top
+}
+
+// 检查 -latency-unit，主命令和 history、bench 子命令共用
+func validateLatencyUnit() error {
+	if *latencyUnit != "ms" && *latencyUnit != "s" {
+		return fmt.Errorf("不支持的延迟单位: %s (可选 ms|s)", *latencyUnit)
+	}
+	return nil
+}
+
+// 把毫秒换算为 -latency-unit 指定的单位
+func latencyIn(ms float64) float64 {
+	if *latencyUnit == "s" {
+		return ms / 1000
+	}
+	return ms
+}
+
+// 格式化延迟并标注单位
+func formatLatency(ms float64) string {
+	if *latencyUnit == "s" {
+		return strconv.FormatFloat(latencyIn(ms), 'f', 3, 64) + "s"
+	}
+	return strconv.FormatFloat(ms, 'f', 2, 64) + "ms"
+}
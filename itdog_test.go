@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"maps"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestParsePingRows(t *testing.T) {
+	rows := []pingRow{
+		{Node: "北京电信", IP: "1.1.1.1", Time: "12ms"},
+		{Node: "上海联通", IP: "1.1.1.2", Time: " 0.025s "},
+		{Node: "广东移动", IP: "1.1.1.3", Time: "超时"},
+		{Node: "江苏电信", IP: "1.1.1.4", Time: ""},
+		{Node: "浙江联通", IP: "1.1.1.5", Time: "abc ms"},
+		{Node: "四川移动", IP: "", Time: "30"},
+		{Node: "湖北电信", IP: "1.1.1.6", Time: "NaN"},
+		{Node: "湖南联通", IP: "1.1.1.7", Time: "-5ms"},
+		{Node: "河南移动", IP: "1.1.1.8", Time: "+Inf s"},
+	}
+	want := []PingResult{
+		{Node: "北京电信", IP: "1.1.1.1", Time: 12},
+		{Node: "上海联通", IP: "1.1.1.2", Time: 25},
+		{Node: "广东移动", IP: "1.1.1.3", Timeout: true},
+		{Node: "江苏电信", IP: "1.1.1.4", Timeout: true},
+		{Node: "浙江联通", IP: "1.1.1.5", Timeout: true},
+		{Node: "四川移动", IP: "", Time: 30},
+		{Node: "湖北电信", IP: "1.1.1.6", Timeout: true},
+		{Node: "湖南联通", IP: "1.1.1.7", Timeout: true},
+		{Node: "河南移动", IP: "1.1.1.8", Timeout: true},
+	}
+	if got := parsePingRows(rows); !slices.Equal(got, want) {
+		t.Errorf("parsePingRows() =\n%v\nwant\n%v", got, want)
+	}
+}
+
+func TestFindFastestIP(t *testing.T) {
+	tests := []struct {
+		name    string
+		rows    []pingRow
+		wantIP  string
+		wantAvg float64
+		wantErr error
+	}{
+		{
+			name: "按平均延迟选择",
+			rows: []pingRow{
+				{Node: "北京电信", IP: "1.1.1.1", Time: "30ms"},
+				{Node: "上海联通", IP: "1.1.1.1", Time: "10ms"},
+				{Node: "广东移动", IP: "2.2.2.2", Time: "15ms"},
+				{Node: "江苏电信", IP: "2.2.2.2", Time: "超时"},
+			},
+			wantIP: "2.2.2.2", wantAvg: 15,
+		},
+		{
+			name: "全部节点超时",
+			rows: []pingRow{
+				{Node: "北京电信", IP: "1.1.1.1", Time: "超时"},
+				{Node: "上海联通", IP: "1.1.1.2", Time: "-"},
+			},
+			wantErr: ErrAllTimeout,
+		},
+		{
+			name:    "没有节点",
+			wantErr: ErrNoDomesticIP,
+		},
+		{
+			name:    "节点没有IP",
+			rows:    []pingRow{{Node: "北京电信", Time: "12ms"}},
+			wantErr: ErrNoDomesticIP,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ip, avg, err := findFastestIP(parsePingRows(tt.rows))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if ip != tt.wantIP || avg != tt.wantAvg {
+				t.Errorf("findFastestIP() = %s %v, want %s %v", ip, avg, tt.wantIP, tt.wantAvg)
+			}
+		})
+	}
+}
+
+func TestValidatePings(t *testing.T) {
+	setFlag(t, &out, io.Discard)
+	pings := []PingResult{
+		{Node: "正常", IP: "1.1.1.1", Time: 12},
+		{Node: "超时", IP: "1.1.1.2", Timeout: true},
+		{Node: "IP为空", Time: 12},
+		{Node: "IP无效", IP: "1.1.1", Time: 12},
+		{Node: "负数", IP: "1.1.1.3", Time: -1},
+		{Node: "NaN", IP: "1.1.1.4", Time: math.NaN()},
+		{Node: "Inf", IP: "1.1.1.5", Time: math.Inf(1)},
+		{Node: "超出范围", IP: "1.1.1.6", Time: maxPingTime + 1},
+		{Node: "超时且IP无效", IP: "x", Timeout: true},
+	}
+	got := validatePings("a.com", pings)
+	if want := pings[:2]; !slices.Equal(got, want) {
+		t.Errorf("validatePings() = %v, want %v", got, want)
+	}
+
+	// 不使用 -strict-validation 时，NaN、Inf 和负数的响应时间也不能被选中
+	lenient := slices.DeleteFunc(slices.Clone(pings), func(p PingResult) bool { return p.Node == "IP无效" })
+	ip, avg, err := findFastestIP(lenient)
+	if err != nil || ip != "1.1.1.1" || avg != 12 {
+		t.Errorf("findFastestIP() = %s %v %v, want 1.1.1.1 12", ip, avg, err)
+	}
+}
+
+// 读取自定义节点映射后按映射中的地区和运营商过滤，映射中没有的节点仍按名称判断
+func TestNodeRegionMap(t *testing.T) {
+	t.Cleanup(func() { nodeRegionMap = maps.Clone(builtinNodeRegions) })
+	path := filepath.Join(t.TempDir(), "nodes.json")
+	data := `{"首都节点": {"region": "北京", "isp": "电信"}, "网通": {"isp": "网通"}}`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadNodeRegionMap(path); err != nil {
+		t.Fatal(err)
+	}
+
+	pings := []PingResult{
+		{Node: "首都节点1", IP: "1.1.1.1"},
+		{Node: "北京联通", IP: "1.1.1.2"},
+		{Node: "辽宁网通", IP: "1.1.1.3"},
+		{Node: "内蒙移动", IP: "1.1.1.4"},
+		{Node: cacheNode, IP: "1.1.1.5"},
+	}
+	nodes := func(results []PingResult) []string {
+		var names []string
+		for _, p := range results {
+			names = append(names, p.Node)
+		}
+		return names
+	}
+	tests := []struct {
+		name   string
+		filter func([]PingResult) []PingResult
+		want   []string
+	}{
+		{"地区 北京", func(p []PingResult) []PingResult { return filterRegions(p, []string{"北京"}) }, []string{"首都节点1", "北京联通", cacheNode}},
+		{"内置映射 内蒙古", func(p []PingResult) []PingResult { return filterRegions(p, []string{" 内蒙古 ", ""}) }, []string{"内蒙移动", cacheNode}},
+		{"按映射片段的写法指定地区", func(p []PingResult) []PingResult { return filterRegions(p, []string{"内蒙"}) }, []string{"内蒙移动", cacheNode}},
+		{"按映射片段的写法指定运营商", func(p []PingResult) []PingResult { return filterISP(p, "铁通") }, []string{"内蒙移动", cacheNode}},
+		{"运营商 电信", func(p []PingResult) []PingResult { return filterISP(p, "电信") }, []string{"首都节点1", cacheNode}},
+		{"文件覆盖内置映射", func(p []PingResult) []PingResult { return filterISP(p, "网通") }, []string{"辽宁网通", cacheNode}},
+		{"运营商 联通", func(p []PingResult) []PingResult { return filterISP(p, "联通") }, []string{"北京联通", cacheNode}},
+	}
+	for _, tt := range tests {
+		if got := nodes(tt.filter(pings)); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	if err := os.WriteFile(path, []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadNodeRegionMap(path); err == nil {
+		t.Error("格式错误的映射文件没有返回错误")
+	}
+}
+
+// 依次返回预先准备的探测结果
+type fixtureProvider struct {
+	runs [][]PingResult
+	n    int
+}
+
+func (p *fixtureProvider) Probe(ctx context.Context, domain string) ([]string, []PingResult, error) {
+	if p.n >= len(p.runs) {
+		return nil, nil, errors.New("没有更多的数据")
+	}
+	pings := p.runs[p.n]
+	p.n++
+	var ips []string
+	for _, r := range pings {
+		if !slices.Contains(ips, r.IP) {
+			ips = append(ips, r.IP)
+		}
+	}
+	return ips, pings, nil
+}
+
+// -runs 多次探测的结果合并后按IP取平均
+func TestProbeRepeatedAverages(t *testing.T) {
+	setFlag(t, runsInterval, 0)
+	provider := &fixtureProvider{runs: [][]PingResult{
+		{
+			{Node: "北京电信", IP: "1.1.1.1", Time: 10},
+			{Node: "上海联通", IP: "2.2.2.2", Time: 20},
+		},
+		{
+			{Node: "北京电信", IP: "1.1.1.1", Time: 50},
+			{Node: "上海联通", IP: "2.2.2.2", Time: 24},
+			{Node: "广东移动", IP: "3.3.3.3", Timeout: true},
+		},
+	}}
+	ips, pings, err := probeRepeated(context.Background(), provider, "a.com", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"1.1.1.1", "2.2.2.2", "3.3.3.3"}; !slices.Equal(ips, want) {
+		t.Errorf("ips = %v, want %v", ips, want)
+	}
+	stats := rankIPs(pings)
+	if len(stats) != 2 {
+		t.Fatalf("rankIPs() = %v", stats)
+	}
+	want := []struct {
+		ip    string
+		avg   float64
+		count int
+	}{{"2.2.2.2", 22, 2}, {"1.1.1.1", 30, 2}}
+	for i, w := range want {
+		if s := stats[i]; s.IP != w.ip || s.Avg != w.avg || s.Count != w.count {
+			t.Errorf("stats[%d] = %s avg %v count %d, want %s avg %v count %d", i, s.IP, s.Avg, s.Count, w.ip, w.avg, w.count)
+		}
+	}
+
+	// 部分探测失败时使用其余的结果
+	provider = &fixtureProvider{runs: provider.runs[:1]}
+	if _, pings, err := probeRepeated(context.Background(), provider, "a.com", 3); err != nil || len(pings) != 2 {
+		t.Errorf("probeRepeated() = %v, %v", pings, err)
+	}
+}
+
+func TestPickTop(t *testing.T) {
+	stats := []IPStat{
+		{IP: "1.1.1.1", Location: "上海电信", Avg: 10},
+		{IP: "2.2.2.2", Location: "北京联通", Avg: 20},
+		{IP: "3.3.3.3", Location: "广东移动", Avg: 30},
+		{IP: "4.4.4.4", Location: "北京电信", Avg: 40},
+	}
+	ips := func(stats []IPStat) []string {
+		var ips []string
+		for _, s := range stats {
+			ips = append(ips, s.IP)
+		}
+		return ips
+	}
+	tests := []struct {
+		n      int
+		region string
+		want   []string
+	}{
+		{2, "", []string{"1.1.1.1", "2.2.2.2"}},
+		{3, "北京", []string{"2.2.2.2", "1.1.1.1", "3.3.3.3"}},
+		{4, "北京", []string{"2.2.2.2", "4.4.4.4", "1.1.1.1", "3.3.3.3"}},
+		{10, "", []string{"1.1.1.1", "2.2.2.2", "3.3.3.3", "4.4.4.4"}},
+	}
+	for _, tt := range tests {
+		if got := ips(pickTop(stats, tt.n, tt.region)); !slices.Equal(got, tt.want) {
+			t.Errorf("pickTop(%d, %q) = %v, want %v", tt.n, tt.region, got, tt.want)
+		}
+	}
+}
+
+func TestItdogURL(t *testing.T) {
+	tests := []struct {
+		test, domain, want string
+	}{
+		{"ping", "github.com", "https://www.itdog.cn/ping/github.com"},
+		{"http", "a b/c?d=1&e#f", "https://www.itdog.cn/http/a%20b%2Fc%3Fd=1&e%23f"},
+		{"ping", "例子.中国", "https://www.itdog.cn/ping/%E4%BE%8B%E5%AD%90.%E4%B8%AD%E5%9B%BD"},
+	}
+	for _, tt := range tests {
+		if got := itdogURL(tt.test, tt.domain); got != tt.want {
+			t.Errorf("itdogURL(%q, %q) = %s, want %s", tt.test, tt.domain, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 创建解析器。servers为逗号分隔的DNS服务器，为空时使用系统解析，
+// 否则依次轮流向这些服务器查询，避免使用可能被污染的系统DNS
+func newResolver(servers string) *net.Resolver {
+	var addrs []string
+	for s := range strings.SplitSeq(servers, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(s); err != nil {
+			s = net.JoinHostPort(s, "53")
+		}
+		addrs = append(addrs, s)
+	}
+	if len(addrs) == 0 {
+		return net.DefaultResolver
+	}
+
+	var (
+		mu   sync.Mutex
+		next int
+	)
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			mu.Lock()
+			addr := addrs[next%len(addrs)]
+			next++
+			mu.Unlock()
+
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}
+}
+
+// 在本机解析域名，并测量到每个IP的443端口的TCP连接时间
+type localProvider struct {
+	resolver *net.Resolver
+
+	// 本机可以路由的地址族，单栈主机上不去连接另一族的地址
+	v4, v6 bool
+}
+
+func newLocalProvider(resolver *net.Resolver) *localProvider {
+	p := &localProvider{resolver: resolver, v4: hasIPv4Route(), v6: hasIPv6Route()}
+	verbosef("本机地址族: IPv4=%v IPv6=%v\n", p.v4, p.v6)
+	return p
+}
+
+func (p *localProvider) Probe(ctx context.Context, domain string) ([]string, []PingResult, error) {
+	addrs, err := p.resolver.LookupIPAddr(ctx, domain)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var ips []string
+	for _, addr := range addrs {
+		ip := addr.IP.String()
+		if blocklisted(addr.IP) {
+			verbosef("跳过 %s 的 %s: 在 -blocklist 中\n", domain, ip)
+			continue
+		}
+		if v4 := addr.IP.To4() != nil; v4 && !p.v4 || !v4 && !p.v6 {
+			verbosef("跳过 %s 的 %s: 本机没有该地址族的路由\n", domain, ip)
+			continue
+		}
+		ips = append(ips, ip)
+	}
+
+	// 每个IP依次连接 -dials 次，各IP之间并发。失败的连接记为超时，
+	// 由 rankIPs 计入丢失率，从而发现偶尔能连上但经常失败的IP
+	n := max(*dials, 1)
+	pings := make([]PingResult, len(ips)*n)
+	var wg sync.WaitGroup
+	for i, ip := range ips {
+		wg.Go(func() {
+			for j := range n {
+				pings[i*n+j] = dialPing(ctx, ip)
+			}
+		})
+	}
+	wg.Wait()
+	if n > 1 {
+		for _, s := range rankIPs(pings) {
+			verbosef("%s %s: 成功率 %.0f%%，平均连接时间 %s\n", domain, s.IP, (1-s.Loss)*100, formatLatency(s.Avg))
+		}
+	}
+	return ips, pings, nil
+}
+
+// 本机探测使用的拨号器，-probe-timeout 和 -probe-keepalive 在这里生效。
+// 不支持TCP Fast Open：测量的是握手时间，而TFO会把握手推迟到第一次写入数据，
+// 连接会立即"成功"，各IP之间无法比较
+func probeDialer() *net.Dialer {
+	d := &net.Dialer{Timeout: *probeTimeout}
+	if !*probeKeepAlive {
+		d.KeepAlive = -1
+	}
+	return d
+}
+
+// 测量一次到ip:443的TCP连接时间，超时由 -probe-timeout 指定
+func dialPing(ctx context.Context, ip string) PingResult {
+	return dialPort(ctx, ip, "443")
+}
+
+// 测量一次到ip:port的TCP连接时间
+func dialPort(ctx context.Context, ip, port string) PingResult {
+	p := PingResult{Node: "本机", IP: ip}
+	d := probeDialer()
+	start := time.Now()
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(ip, port))
+	if err != nil {
+		p.Timeout = true
+		return p
+	}
+	p.Time = float64(time.Since(start).Microseconds()) / 1000
+	conn.Close()
+	return p
+}
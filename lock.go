@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// 获取实例锁，防止定时任务重叠运行。锁文件记录持有者的PID，
+// 持有者已退出（如被强制结束）时视为过期锁并接管。force为true时不检查
+func acquireLock(path string, force bool) (release func(), err error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+
+	for {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err == nil {
+			fmt.Fprintf(f, "%d\n", os.Getpid())
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, err
+		}
+
+		data, _ := os.ReadFile(path)
+		pid, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+		if !force && pid > 0 && processAlive(pid) {
+			return nil, fmt.Errorf("已有实例正在运行 (PID %d, 锁文件 %s)，如确认没有运行可使用 -force", pid, path)
+		}
+		if !force {
+			fmt.Fprintf(out, "🧹 清理过期的锁文件 %s\n", path)
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+}
+
+// 检查进程是否仍在运行
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		// Windows上FindProcess只会为存在的进程返回成功
+		return true
+	}
+	// 信号0只做检查；EPERM表示进程存在但属于其他用户
+	err = p.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, fs.ErrPermission)
+}
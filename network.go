@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"slices"
+	"strings"
+	"time"
+)
+
+var ErrNoIPv6 = errors.New("仅IPv6网络下没有可用的IPv6候选IP")
+
+// 本机是否只有IPv6网络
+var ipv6Only bool
+
+// 检测本机是否有可用的IPv4路由。UDP的Dial不发送数据，
+// 没有路由时会立即返回 network is unreachable
+func hasIPv4Route() bool {
+	conn, err := net.DialTimeout("udp4", "223.5.5.5:53", time.Second)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// 检测本机是否有可用的IPv6路由
+func hasIPv6Route() bool {
+	conn, err := net.DialTimeout("udp6", "[2400:3200::1]:53", time.Second)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// 只保留IPv6地址的检测结果
+func onlyIPv6(results []PingResult) []PingResult {
+	var v6 []PingResult
+	for _, p := range results {
+		if ip := net.ParseIP(p.IP); ip != nil && ip.To4() == nil {
+			v6 = append(v6, p)
+		}
+	}
+	return v6
+}
+
+// 粗略的网络指纹：默认出口网卡所在子网的哈希，同一网络下通常不变。
+// 只在本机计算，不访问外部服务；缓存中只保存哈希值，不保存地址本身，
+// 但同一网络的哈希相同，缓存文件仍能看出两次运行是否在同一网络中。
+// 无法确定出口时返回"unknown"
+func networkFingerprint() string {
+	subnet := outboundSubnet()
+	if subnet == "" {
+		return "unknown"
+	}
+	h := fnv.New64a()
+	h.Write([]byte(subnet))
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+// 默认出口所在的子网。UDP的Dial不发送数据，只用于让系统选择出口地址
+func outboundSubnet() string {
+	for _, target := range []string{"223.5.5.5:53", "[2400:3200::1]:53"} {
+		conn, err := net.DialTimeout("udp", target, time.Second)
+		if err != nil {
+			continue
+		}
+		local := conn.LocalAddr().(*net.UDPAddr).IP
+		conn.Close()
+		if subnet := localSubnet(local); subnet != "" {
+			return subnet
+		}
+	}
+	return ""
+}
+
+// 网络变化的检测间隔
+const networkPollInterval = 5 * time.Second
+
+// 定期检查出口子网和各网卡的地址，发生变化（切换Wi-Fi、网卡启停、默认路由改变）时
+// 发出通知。使用轮询而不是各平台的路由通知接口，所有平台行为一致且不需要额外依赖
+func watchNetwork(ctx context.Context) <-chan struct{} {
+	changed := make(chan struct{}, 1)
+	go func() {
+		last := networkState()
+		ticker := time.NewTicker(networkPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if state := networkState(); state != last {
+				last = state
+				select {
+				case changed <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+	return changed
+}
+
+// 当前网络状态的摘要：出口子网加上所有已启用网卡的地址
+func networkState() string {
+	parts := []string{outboundSubnet()}
+	ifaces, _ := net.Interfaces()
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, _ := iface.Addrs()
+		for _, addr := range addrs {
+			parts = append(parts, iface.Name+"="+addr.String())
+		}
+	}
+	slices.Sort(parts[1:])
+	return strings.Join(parts, ",")
+}
+
+// 本机地址所在的子网，如 192.168.1.0/24
+func localSubnet(ip net.IP) string {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return ""
+	}
+	for _, iface := range ifaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if n, ok := addr.(*net.IPNet); ok && n.IP.Equal(ip) {
+				return (&net.IPNet{IP: ip.Mask(n.Mask), Mask: n.Mask}).String()
+			}
+		}
+	}
+	return ""
+}
+
+// 是否为IPv6地址
+func isIPv6(ip string) bool {
+	addr := net.ParseIP(ip)
+	return addr != nil && addr.To4() == nil
+}
+
+// -dual-write：除选出的IP外，再写入另一地址族中最快的IP，双栈网络下两种连接都能加速。
+// 另一地址族没有候选时只写一个；写入hosts时该域名的条目整体替换，
+// 之前写入的另一地址族的条目会被删除，不会残留
+func addOtherFamily(r *Result) {
+	ips := r.hostIPs()
+	if slices.ContainsFunc(ips, func(ip string) bool { return isIPv6(ip) != isIPv6(r.IP) }) {
+		return
+	}
+	for _, c := range r.Candidates {
+		if isIPv6(c.IP) != isIPv6(r.IP) {
+			r.Top = append(ips, c.IP)
+			return
+		}
+	}
+}
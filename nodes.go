@@ -0,0 +1,99 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+)
+
+// 节点的地区和运营商
+type nodeLabel struct {
+	Region string `json:"region"`
+	ISP    string `json:"isp"`
+}
+
+// 内置的节点映射，只收录名称中不直接包含地区或运营商的节点，
+// 标签中为空的字段仍按节点名称判断
+var builtinNodeRegions = map[string]nodeLabel{
+	"内蒙":     {Region: "内蒙古"},
+	"黑龙":     {Region: "黑龙江"},
+	"网通":     {ISP: "联通"}, // 已并入联通
+	"铁通":     {ISP: "移动"}, // 已并入移动
+	"CERNET": {ISP: "教育网"},
+	"长城宽带":   {ISP: "鹏博士"},
+}
+
+// 节点名称片段到标签的映射，-node-region-map 的内容合并在内置映射之上
+var nodeRegionMap = maps.Clone(builtinNodeRegions)
+
+// 读取节点映射文件并合并到内置映射，同一片段以文件为准
+func loadNodeRegionMap(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	m := make(map[string]nodeLabel)
+	if err := json.Unmarshal(data, &m); err != nil {
+		return fmt.Errorf("解析节点映射 %s 失败: %w", path, err)
+	}
+	maps.Copy(nodeRegionMap, m)
+	return nil
+}
+
+// 查找节点在映射中的标签，多个片段匹配时取最长的片段
+func lookupNodeLabel(node string) (nodeLabel, bool) {
+	var patterns []string
+	for pattern := range nodeRegionMap {
+		if strings.Contains(node, pattern) {
+			patterns = append(patterns, pattern)
+		}
+	}
+	if len(patterns) == 0 {
+		return nodeLabel{}, false
+	}
+	best := slices.MaxFunc(patterns, func(a, b string) int {
+		if c := cmp.Compare(len(a), len(b)); c != 0 {
+			return c
+		}
+		return strings.Compare(b, a)
+	})
+	return nodeRegionMap[best], true
+}
+
+// 节点是否属于指定地区。映射中有该节点的地区时精确比较，
+// 否则按节点名称是否包含地区名判断
+func nodeInRegion(node, region string) bool {
+	if l, ok := lookupNodeLabel(node); ok && l.Region != "" {
+		return l.Region == region
+	}
+	return strings.Contains(node, region)
+}
+
+// 节点是否属于指定运营商，规则同 nodeInRegion
+func nodeHasISP(node, isp string) bool {
+	if l, ok := lookupNodeLabel(node); ok && l.ISP != "" {
+		return l.ISP == isp
+	}
+	return strings.Contains(node, isp)
+}
+
+// 把用户指定的地区按映射换成规范名称，如 内蒙 -> 内蒙古，
+// 否则 -regions 按映射片段的写法指定时匹配不到任何节点
+func canonicalRegion(region string) string {
+	if l, ok := lookupNodeLabel(region); ok && l.Region != "" {
+		return l.Region
+	}
+	return region
+}
+
+// 把用户指定的运营商按映射换成规范名称，如 网通 -> 联通
+func canonicalISP(isp string) string {
+	if l, ok := lookupNodeLabel(isp); ok && l.ISP != "" {
+		return l.ISP
+	}
+	return isp
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"cmp"
+	"flag"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// normalize 子命令：把hosts整理为规范格式，不改变任何IP。
+// 整理后的内容再次整理不会有变化，可以放心地重复运行
+func normalizeCmd(args []string) error {
+	fs := flag.NewFlagSet("normalize", flag.ExitOnError)
+	fs.BoolVar(dryRun, "dry-run", false, "只输出整理后的内容，不修改hosts")
+	fs.StringVar(sectionName, "section-name", *sectionName, "管理区块的名称")
+	fs.StringVar(container, "container", "", "整理指定Docker容器的hosts")
+	fs.IntVar(backupCount, "backups", *backupCount, "修改hosts前备份，最多保留的份数，0表示不备份")
+	fs.Parse(args)
+
+	path, err := hostsFilePath()
+	if err != nil {
+		return err
+	}
+	lines, err := readHostsLines(path)
+	if err != nil {
+		return err
+	}
+
+	normalized := normalizeHosts(lines)
+	if *dryRun {
+		for _, line := range normalized {
+			fmt.Println(line)
+		}
+		return nil
+	}
+	if slices.Equal(lines, normalized) {
+		fmt.Fprintf(out, "✅ %s 已是规范格式\n", path)
+		return nil
+	}
+	if err := backupHosts(path, "整理格式"); err != nil {
+		fmt.Fprintf(out, "⚠️ 备份hosts失败: %v\n", err)
+	}
+	if err := writeHostsLines(path, normalized); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "🧹 已整理 %s\n", path)
+	return nil
+}
+
+// 规范化hosts内容：
+//   - 去掉行首尾的空白，字段之间只保留一个空格，行尾注释保留
+//   - 合并连续的空行，去掉文件末尾的空行
+//   - 去掉区块外完全重复的条目，只保留第一条
+//   - 多个管理区块合并为一个，条目按域名排序（同一域名的IP保持原有顺序）并去重，
+//     起始行保持不变
+func normalizeHosts(lines []string) []string {
+	type entry struct{ ip, domain string }
+	var (
+		result  []string
+		entries []entry
+		header  string
+		blockAt = -1
+		inBlock bool
+	)
+	seen := make(map[string]bool)
+	for _, raw := range lines {
+		line := strings.TrimSpace(raw)
+
+		if isMarker(line, blockBegin()) {
+			if !inBlock && blockAt < 0 {
+				blockAt, header = len(result), line
+			}
+			inBlock = true
+			continue
+		}
+		if isMarker(line, blockEnd()) {
+			inBlock = false
+			continue
+		}
+
+		if inBlock {
+			fields := strings.Fields(line)
+			if len(fields) < 2 || strings.HasPrefix(line, "#") {
+				continue
+			}
+			for _, domain := range fields[1:] {
+				if e := (entry{fields[0], domain}); !slices.Contains(entries, e) {
+					entries = append(entries, e)
+				}
+			}
+			continue
+		}
+
+		switch {
+		case line == "":
+			if len(result) > 0 && result[len(result)-1] != "" {
+				result = append(result, "")
+			}
+		case strings.HasPrefix(line, "#"):
+			result = append(result, line)
+		default:
+			line = normalizeHostLine(line)
+			if !seen[line] {
+				seen[line] = true
+				result = append(result, line)
+			}
+		}
+	}
+
+	if len(entries) > 0 {
+		slices.SortStableFunc(entries, func(a, b entry) int { return cmp.Compare(a.domain, b.domain) })
+		block := []string{header}
+		for _, e := range entries {
+			block = append(block, e.ip+" "+e.domain)
+		}
+		result = slices.Insert(result, blockAt, append(block, blockEnd())...)
+	}
+	for len(result) > 0 && result[len(result)-1] == "" {
+		result = result[:len(result)-1]
+	}
+	return result
+}
+
+// 条目行的字段之间只保留一个空格，行尾注释原样保留
+func normalizeHostLine(line string) string {
+	entry, comment, hasComment := strings.Cut(line, "#")
+	line = strings.Join(strings.Fields(entry), " ")
+	if hasComment {
+		line += " #" + strings.TrimRight(comment, " \t")
+	}
+	return line
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// 通知中最多列出的域名数
+const maxNotifyDomains = 5
+
+// -notify：hosts中的条目有变化时发送桌面通知，概括变化的域名
+func notifyChanges(results []Result) {
+	var changes []string
+	for _, r := range results {
+		switch r.Action {
+		case actionAdded, actionUpdated:
+			changes = append(changes, r.Domain+" -> "+r.IP)
+		case actionRemoved:
+			changes = append(changes, r.Domain+" 已删除")
+		}
+	}
+	if len(changes) == 0 {
+		return
+	}
+	body := strings.Join(changes[:min(len(changes), maxNotifyDomains)], "\n")
+	if len(changes) > maxNotifyDomains {
+		body += fmt.Sprintf("\n等 %d 个域名", len(changes))
+	}
+	if err := sendNotification(fmt.Sprintf("fastip 更新了 %d 个域名", len(changes)), body); err != nil {
+		// 没有桌面环境或通知工具时静默跳过
+		verbosef("发送桌面通知失败: %v\n", err)
+	}
+}
+
+// 用系统自带的方式发送桌面通知
+func sendNotification(title, body string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "linux":
+		cmd = exec.Command("notify-send", "-a", "fastip", title, body)
+	case "darwin":
+		// 通过参数传入文本，避免在AppleScript中转义
+		cmd = exec.Command("osascript",
+			"-e", "on run argv",
+			"-e", "display notification (item 2 of argv) with title (item 1 of argv)",
+			"-e", "end run",
+			title, body)
+	case "windows":
+		// 通过环境变量传入文本，避免在PowerShell中转义
+		cmd = exec.Command("powershell", "-NoProfile", "-Command", windowsToastScript)
+		cmd.Env = append(os.Environ(), "FASTIP_NOTIFY_TITLE="+title, "FASTIP_NOTIFY_BODY="+body)
+	default:
+		return fmt.Errorf("不支持的操作系统: %s", runtime.GOOS)
+	}
+	return cmd.Run()
+}
+
+// 使用Windows自带的toast通知，不依赖第三方模块
+const windowsToastScript = `[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] > $null
+$xml = [Windows.UI.Notifications.ToastNotificationManager]::GetTemplateContent([Windows.UI.Notifications.ToastTemplateType]::ToastText02)
+$text = $xml.GetElementsByTagName('text')
+$text.Item(0).AppendChild($xml.CreateTextNode($env:FASTIP_NOTIFY_TITLE)) > $null
+$text.Item(1).AppendChild($xml.CreateTextNode($env:FASTIP_NOTIFY_BODY)) > $null
+[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier('fastip').Show([Windows.UI.Notifications.ToastNotification]::new($xml))`
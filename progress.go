@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// 批量探测的进度提示，写到stderr，不会混入 -json 的输出。
+// 指定 -quiet 或stderr不是终端（被重定向、在管道中）时不显示。
+// 指定 -dashboard 时改为在原地刷新的状态表，每个域名一行
+type progress struct {
+	mu        sync.Mutex
+	total     int
+	done      int
+	enabled   bool
+	dashboard bool
+
+	domains []string          // 状态表中域名的顺序
+	status  map[string]string // 每个域名的状态
+	drawn   int               // 上次绘制的行数，重绘时先回到这些行的开头
+
+	// 状态表显示期间其他信息先暂存，避免与原地刷新的状态表交错
+	logs    []string
+	partial string
+	saved   io.Writer
+}
+
+// 状态表最多显示的域名行数，超出时只显示进行中和失败的域名
+const maxDashboardRows = 30
+
+// 状态表下方显示的最近信息的行数
+const dashboardLogRows = 5
+
+func newProgress(domains []string) *progress {
+	p := &progress{total: len(domains), enabled: len(domains) > 1 && !*quiet && isTerminal(os.Stderr)}
+	if p.enabled && *dashboard {
+		p.dashboard = true
+		p.domains = domains
+		p.status = make(map[string]string, len(domains))
+		for _, d := range domains {
+			p.status[d] = "⏸️ 等待"
+		}
+	}
+	return p
+}
+
+// 开始显示状态表：之后写到 out 的信息（重试、忽略的IP、验证、分批写入等）
+// 暂存起来，状态表下方只显示最近几行，Finish 时再完整输出
+func (p *progress) Capture() {
+	if !p.dashboard {
+		return
+	}
+	p.saved = out
+	out = p
+}
+
+// 结束状态表，恢复 out 并输出暂存的信息
+func (p *progress) Finish() {
+	if !p.dashboard || p.saved == nil {
+		return
+	}
+	out = p.saved
+	p.saved = nil
+	p.mu.Lock()
+	logs := p.logs
+	if p.partial != "" {
+		logs = append(logs, p.partial)
+	}
+	p.logs, p.partial = nil, ""
+	p.mu.Unlock()
+	p.redraw()
+	for _, line := range logs {
+		fmt.Fprintln(out, line)
+	}
+}
+
+// 暂存写到 out 的信息。调用方可能持有 printMu，这里不重绘，下次刷新时显示
+func (p *progress) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	lines := strings.Split(p.partial+string(b), "\n")
+	p.partial = lines[len(lines)-1]
+	for _, line := range lines[:len(lines)-1] {
+		if line != "" {
+			p.logs = append(p.logs, line)
+		}
+	}
+	return len(b), nil
+}
+
+// 开始探测一个域名
+func (p *progress) Start(domain string) {
+	if !p.enabled {
+		return
+	}
+	p.mu.Lock()
+	done := p.done
+	if p.dashboard {
+		p.status[domain] = "⏳ 查询中"
+	}
+	p.mu.Unlock()
+
+	if p.dashboard {
+		p.redraw()
+		return
+	}
+	p.print(done, "正在查询 "+domain+"...")
+}
+
+// 一个域名探测完成
+func (p *progress) Done(r Result) {
+	if !p.enabled {
+		return
+	}
+	p.mu.Lock()
+	p.done++
+	done := p.done
+	if p.dashboard {
+		if r.Error != "" {
+			p.status[r.Domain] = "❌ " + r.Error
+		} else {
+			p.status[r.Domain] = "✅ " + r.IP + " " + formatLatency(r.Latency)
+		}
+	}
+	p.mu.Unlock()
+
+	if p.dashboard {
+		p.redraw()
+		return
+	}
+	p.print(done, "已完成 "+r.Domain)
+}
+
+func (p *progress) print(done int, msg string) {
+	printMu.Lock()
+	defer printMu.Unlock()
+	fmt.Fprintf(os.Stderr, "[%d/%d] %s\n", done, p.total, msg)
+}
+
+// 回到上次绘制的状态表开头，清除到屏幕末尾后重新绘制
+func (p *progress) redraw() {
+	printMu.Lock()
+	defer printMu.Unlock()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var b strings.Builder
+	if p.drawn > 0 {
+		fmt.Fprintf(&b, "\x1b[%dA\x1b[J", p.drawn)
+	}
+	ok, failed := 0, 0
+	var rows []string
+	for _, d := range p.domains {
+		s := p.status[d]
+		switch {
+		case strings.HasPrefix(s, "✅"):
+			ok++
+		case strings.HasPrefix(s, "❌"):
+			failed++
+		}
+		if len(p.domains) <= maxDashboardRows || strings.HasPrefix(s, "⏳") || strings.HasPrefix(s, "❌") {
+			rows = append(rows, fmt.Sprintf("%-40s %s", d, s))
+		}
+	}
+	if len(rows) > maxDashboardRows {
+		rows = rows[len(rows)-maxDashboardRows:]
+	}
+	fmt.Fprintf(&b, "[%d/%d] 成功 %d  失败 %d  未完成 %d\n", p.done, p.total, ok, failed, p.total-p.done)
+	for _, row := range rows {
+		b.WriteString(row + "\n")
+	}
+	if p.saved != nil {
+		logs := p.logs[max(len(p.logs)-dashboardLogRows, 0):]
+		for _, line := range logs {
+			b.WriteString("  │ " + line + "\n")
+		}
+		rows = append(rows, logs...)
+	}
+	p.drawn = len(rows) + 1
+	fmt.Fprint(os.Stderr, b.String())
+}
+
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
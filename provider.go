@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// 延迟数据来源
+type LatencyProvider interface {
+	// 返回域名解析到的IP列表和各检测节点的结果
+	Probe(ctx context.Context, domain string) ([]string, []PingResult, error)
+}
+
+// 根据 -provider 创建数据来源，返回的ctx供后续探测使用
+func newProvider() (context.Context, LatencyProvider, context.CancelFunc, error) {
+	if *offline {
+		p, err := newCacheProvider(*cacheFile)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		fmt.Fprintln(out, "📦 离线模式，使用缓存中的IP")
+		return context.Background(), p, func() {}, nil
+	}
+	if *replayDir != "" {
+		fmt.Fprintf(out, "⏪ 重放 %s 中记录的数据，不访问itdog\n", *replayDir)
+		return context.Background(), replayProvider{dir: *replayDir}, func() {}, nil
+	}
+	return openProvider(*providerName)
+}
+
+// 按名称创建数据来源，供 -provider 和 bench 子命令使用
+func openProvider(name string) (context.Context, LatencyProvider, context.CancelFunc, error) {
+	switch name {
+	case "itdog":
+		browser, cancel, err := newBrowser()
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return browser, itdogProvider{test: *testType}, cancel, nil
+	case "local":
+		return context.Background(), newLocalProvider(newResolver(*dnsServers)), func() {}, nil
+	case "mock":
+		p, err := newMockProvider(*mockFile)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		fmt.Fprintln(out, "🧪 使用模拟数据，结果仅用于测试和演示")
+		return context.Background(), p, func() {}, nil
+	default:
+		return nil, nil, nil, fmt.Errorf("不支持的数据来源: %s (可选 itdog|local|mock)", name)
+	}
+}
+
+// 通过无头浏览器读取itdog的检测结果，ctx需来自 newBrowser。
+// test为 http 时使用HTTP测试的首包时间，更接近实际HTTPS访问的体验
+type itdogProvider struct {
+	test string
+}
+
+func (p itdogProvider) Probe(ctx context.Context, domain string) ([]string, []PingResult, error) {
+	ips, pings, err := p.probe(ctx, domain)
+	if err == nil && *recordRaw != "" {
+		if err := recordPings(*recordRaw, domain, pings); err != nil {
+			fmt.Fprintf(out, "⚠️ %s: 保存原始数据失败: %v\n", domain, err)
+		}
+	}
+	return ips, pings, err
+}
+
+func (p itdogProvider) probe(ctx context.Context, domain string) ([]string, []PingResult, error) {
+	if p.test == "http" {
+		ips, pings, err := probeItdogHTTP(ctx, domain)
+		if err == nil {
+			return ips, pings, nil
+		}
+		if ctx.Err() != nil {
+			return nil, nil, err
+		}
+		fmt.Fprintf(out, "⚠️ %s: HTTP测试不可用 (%v)，改用ping测试\n", domain, err)
+	}
+
+	text, rows, err := queryWithRetry(ctx, domain, queryItdog)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var ips []string
+	for ip := range strings.SplitSeq(text, "\n") {
+		ip = strings.TrimSpace(ip)
+		if ip != "" {
+			ips = append(ips, ip)
+		}
+	}
+	return ips, parsePingRows(rows), nil
+}
+
+// HTTP测试的结果，IP列表从各节点的响应IP中汇总。没有任何节点成功时视为不可用
+func probeItdogHTTP(ctx context.Context, domain string) ([]string, []PingResult, error) {
+	_, rows, err := queryWithRetry(ctx, domain, queryItdogHTTP)
+	if err != nil {
+		return nil, nil, err
+	}
+	pings := parsePingRows(rows)
+	if !slices.ContainsFunc(pings, func(p PingResult) bool { return !p.Timeout }) {
+		return nil, nil, errors.New("没有节点返回有效的HTTP响应")
+	}
+
+	var ips []string
+	for _, p := range pings {
+		if p.IP != "" && !slices.Contains(ips, p.IP) {
+			ips = append(ips, p.IP)
+		}
+	}
+	return ips, pings, nil
+}
+
+// 返回固定模拟数据的数据来源，不访问网络。
+// 仅用于测试和演示，不要用于实际修改hosts
+type mockProvider struct {
+	fixture map[string][]PingResult // 为空时按域名生成数据
+}
+
+// 从JSON文件读取模拟数据，path为空时使用内置数据
+func newMockProvider(path string) (*mockProvider, error) {
+	if path == "" {
+		return &mockProvider{}, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var fixture map[string][]PingResult
+	if err := json.Unmarshal(data, &fixture); err != nil {
+		return nil, fmt.Errorf("解析模拟数据 %s 失败: %w", path, err)
+	}
+	return &mockProvider{fixture: fixture}, nil
+}
+
+func (p *mockProvider) Probe(ctx context.Context, domain string) ([]string, []PingResult, error) {
+	pings, ok := p.fixture[domain]
+	if p.fixture == nil {
+		pings, ok = mockPings(domain), true
+	}
+	if !ok {
+		return nil, nil, fmt.Errorf("模拟数据中没有域名 %s", domain)
+	}
+
+	var ips []string
+	seen := make(map[string]bool)
+	for _, ping := range pings {
+		if ping.IP != "" && !seen[ping.IP] {
+			seen[ping.IP] = true
+			ips = append(ips, ping.IP)
+		}
+	}
+	return ips, pings, nil
+}
+
+// -record-raw：把itdog返回的各节点数据（过滤前）保存为 <dir>/<domain>.json，
+// 格式与 -mock-file 相同，可用 -provider mock -mock-file 重放。
+// 多次探测（-probe-count）时保留最后一次
+func recordPings(dir, domain string, pings []PingResult) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(map[string][]PingResult{domain: pings}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(recordPath(dir, domain), data, 0o644)
+}
+
+// -record-raw 和 -replay 使用的文件路径，域名中不能出现在文件名里的字符替换为下划线
+func recordPath(dir, domain string) string {
+	name := strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ':' {
+			return '_'
+		}
+		return r
+	}, domain)
+	return filepath.Join(dir, name+".json")
+}
+
+// -replay：从 -record-raw 记录的文件读取各域名的数据，其余流程与正常运行相同，
+// 可以在没有网络时得到确定的结果
+type replayProvider struct {
+	dir string
+}
+
+func (p replayProvider) Probe(ctx context.Context, domain string) ([]string, []PingResult, error) {
+	data, err := os.ReadFile(recordPath(p.dir, domain))
+	if err != nil {
+		return nil, nil, fmt.Errorf("没有 %s 的记录: %w", domain, err)
+	}
+	var fixture map[string][]PingResult
+	if err := json.Unmarshal(data, &fixture); err != nil {
+		return nil, nil, fmt.Errorf("解析 %s 的记录失败: %w", domain, err)
+	}
+	return (&mockProvider{fixture: fixture}).Probe(ctx, domain)
+}
+
+// 内置模拟数据：按域名哈希生成3个IP（位于198.18.0.0/15测试网段）
+// 和若干节点的固定延迟，同一域名每次结果相同
+func mockPings(domain string) []PingResult {
+	h := fnv.New32a()
+	h.Write([]byte(domain))
+	sum := h.Sum32()
+
+	nodes := []string{"北京电信", "上海联通", "广东移动", "浙江电信", "四川联通", "江苏移动"}
+	var pings []PingResult
+	for i, node := range nodes {
+		n := (sum >> (i % 3 * 8)) & 0xff
+		pings = append(pings, PingResult{
+			Node: node,
+			IP:   fmt.Sprintf("198.18.%d.%d", i%3, n),
+			Time: float64(20 + (sum>>uint(i*4))%80),
+		})
+	}
+	return pings
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// JSON输出的内容：默认是结果数组，启用 -stats 时附带统计，
+// 启用 -echo 时附带写入的hosts区块，启用 -timing 时附带各阶段耗时
+func reportValue(results []Result, stats *Stats, block []string, timing *Timing) any {
+	if stats == nil && block == nil && timing == nil {
+		return results
+	}
+	return struct {
+		Results []Result `json:"results"`
+		Stats   *Stats   `json:"stats,omitempty"`
+		Block   []string `json:"hosts_block,omitempty"`
+		Timing  *Timing  `json:"timing,omitempty"`
+	}{results, stats, block, timing}
+}
+
+// 把本次运行的结果写入报告文件
+func writeReport(path string, results []Result, stats *Stats) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		return writeCSVReport(path, results)
+	}
+
+	data, err := marshalJSON(reportValue(results, stats, nil, nil))
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// CSV报告，每个域名一行
+func writeCSVReport(path string, results []Result) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	w := csv.NewWriter(file)
+	w.Write([]string{"domain", "ip", "latency", "latency_unit", "action", "error"})
+	for _, r := range results {
+		latency := ""
+		if r.Error == "" {
+			latency = strconv.FormatFloat(latencyIn(r.Latency), 'f', -1, 64)
+		}
+		w.Write([]string{r.Domain, strings.Join(r.hostIPs(), " "), latency, *latencyUnit, r.Action, r.Error})
+	}
+	w.Flush()
+	return w.Error()
+}
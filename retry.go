@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// 重试的退避参数
+type backoff struct {
+	initial    time.Duration
+	multiplier float64
+	max        time.Duration
+	jitter     float64 // 随机浮动比例
+	maxElapsed time.Duration
+}
+
+// 重试使用的时钟和随机源，测试时替换为固定的实现
+var (
+	retryNow   = time.Now
+	retrySleep = time.After
+	retryRand  = rand.Float64
+)
+
+// 由命令行参数构造退避参数
+func retryBackoff() backoff {
+	return backoff{
+		initial:    *retryInitial,
+		multiplier: *retryMultiplier,
+		max:        *retryMaxDelay,
+		jitter:     *retryJitter,
+		maxElapsed: *retryMaxElapsed,
+	}
+}
+
+// 第n次重试（从0开始）前的等待时间。rnd为[0,1)内的随机数，
+// 等待时间在基准值的 ±jitter 范围内浮动
+func (b backoff) delay(n int, rnd float64) time.Duration {
+	d := float64(b.initial) * math.Pow(b.multiplier, float64(n))
+	if b.max > 0 {
+		d = min(d, float64(b.max))
+	}
+	d *= 1 + b.jitter*(2*rnd-1)
+	return time.Duration(max(d, 0))
+}
+
+// 查询itdog，失败时按退避参数重试，直到成功、超过最长总耗时或ctx结束
+func queryWithRetry(ctx context.Context, domain string, query func(context.Context, string) (string, []pingRow, error)) (string, []pingRow, error) {
+	b := retryBackoff()
+	start := retryNow()
+	for attempt := 0; ; attempt++ {
+		ips, rows, err := query(ctx, domain)
+		if err == nil || ctx.Err() != nil {
+			return ips, rows, err
+		}
+
+		d := b.delay(attempt, retryRand())
+		if b.maxElapsed <= 0 || retryNow().Sub(start)+d > b.maxElapsed {
+			return ips, rows, err
+		}
+		fmt.Fprintf(out, "🔁 %s 查询失败，%s 后第%d次重试: %v\n", domain, d.Round(time.Millisecond), attempt+1, err)
+
+		select {
+		case <-retrySleep(d):
+		case <-ctx.Done():
+			return ips, rows, err
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"slices"
+	"testing"
+	"time"
+)
+
+// 用固定的时钟替换重试的等待：每次等待立即返回并把时钟拨快相应的时间
+func fakeClock(t *testing.T) *[]time.Duration {
+	t.Helper()
+	clock := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	var waits []time.Duration
+	oldNow, oldSleep, oldRand, oldOut := retryNow, retrySleep, retryRand, out
+	retryNow = func() time.Time { return clock }
+	retrySleep = func(d time.Duration) <-chan time.Time {
+		waits = append(waits, d)
+		clock = clock.Add(d)
+		ch := make(chan time.Time, 1)
+		ch <- clock
+		return ch
+	}
+	retryRand = func() float64 { return 0.5 }
+	out = io.Discard
+	t.Cleanup(func() { retryNow, retrySleep, retryRand, out = oldNow, oldSleep, oldRand, oldOut })
+	return &waits
+}
+
+func setRetryFlags(t *testing.T, initial time.Duration, multiplier float64, maxDelay time.Duration, jitter float64, maxElapsed time.Duration) {
+	t.Helper()
+	old := retryBackoff()
+	*retryInitial, *retryMultiplier, *retryMaxDelay, *retryJitter, *retryMaxElapsed = initial, multiplier, maxDelay, jitter, maxElapsed
+	t.Cleanup(func() {
+		*retryInitial, *retryMultiplier, *retryMaxDelay, *retryJitter, *retryMaxElapsed = old.initial, old.multiplier, old.max, old.jitter, old.maxElapsed
+	})
+}
+
+func TestQueryWithRetryBackoff(t *testing.T) {
+	tests := []struct {
+		name       string
+		multiplier float64
+		maxDelay   time.Duration
+		maxElapsed time.Duration
+		failures   int // 前几次查询失败
+		wantWaits  []time.Duration
+		wantErr    bool
+	}{
+		{
+			name: "指数增长", multiplier: 2, maxDelay: time.Minute, maxElapsed: time.Hour, failures: 3,
+			wantWaits: []time.Duration{time.Second, 2 * time.Second, 4 * time.Second},
+		},
+		{
+			name: "单次等待上限", multiplier: 3, maxDelay: 5 * time.Second, maxElapsed: time.Hour, failures: 4,
+			wantWaits: []time.Duration{time.Second, 3 * time.Second, 5 * time.Second, 5 * time.Second},
+		},
+		{
+			name: "超过最长总耗时后放弃", multiplier: 2, maxDelay: time.Minute, maxElapsed: 5 * time.Second, failures: 10,
+			wantWaits: []time.Duration{time.Second, 2 * time.Second}, wantErr: true,
+		},
+		{
+			name: "最长总耗时为0时不重试", multiplier: 2, maxDelay: time.Minute, failures: 1,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			waits := fakeClock(t)
+			setRetryFlags(t, time.Second, tt.multiplier, tt.maxDelay, 0.2, tt.maxElapsed)
+
+			calls := 0
+			query := func(context.Context, string) (string, []pingRow, error) {
+				calls++
+				if calls <= tt.failures {
+					return "", nil, errors.New("失败")
+				}
+				return "1.1.1.1", nil, nil
+			}
+			_, _, err := queryWithRetry(context.Background(), "example.com", query)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !slices.Equal(*waits, tt.wantWaits) {
+				t.Errorf("等待时间 = %v, want %v", *waits, tt.wantWaits)
+			}
+		})
+	}
+}
+
+func TestBackoffJitter(t *testing.T) {
+	b := backoff{initial: time.Second, multiplier: 2, max: time.Minute, jitter: 0.5}
+	tests := []struct {
+		n    int
+		rnd  float64
+		want time.Duration
+	}{
+		{0, 0, 500 * time.Millisecond},
+		{0, 0.5, time.Second},
+		{1, 0, time.Second},
+		{1, 0.75, 2500 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := b.delay(tt.n, tt.rnd); got != tt.want {
+			t.Errorf("delay(%d, %v) = %v, want %v", tt.n, tt.rnd, got, tt.want)
+		}
+	}
+}
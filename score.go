@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 综合评分中各项指标的权重
+type weights struct {
+	Latency, Jitter, Loss float64
+}
+
+// 当前使用的权重，由 -score-formula 解析
+var scoreWeights = weights{Latency: 1}
+
+// 解析 latency=0.5,jitter=0.3,loss=0.2 形式的权重，未写出的指标权重为0
+func parseScoreFormula(s string) (weights, error) {
+	var w weights
+	for part := range strings.SplitSeq(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return w, fmt.Errorf("无效的评分权重 %q，应为 指标=权重", part)
+		}
+		v, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || v < 0 {
+			return w, fmt.Errorf("无效的评分权重 %q", part)
+		}
+		switch strings.TrimSpace(name) {
+		case "latency":
+			w.Latency = v
+		case "jitter":
+			w.Jitter = v
+		case "loss":
+			w.Loss = v
+		default:
+			return w, fmt.Errorf("未知的评分指标 %q (可选 latency|jitter|loss)", name)
+		}
+	}
+	if w.Latency+w.Jitter+w.Loss == 0 {
+		return w, fmt.Errorf("评分权重不能全为0")
+	}
+	return w, nil
+}
+
+// 计算每个IP的综合得分。各指标先在全部候选中按最小-最大值归一化到[0,1]，
+// 再按权重加权求和；所有候选某项指标相同时该项记为0。
+// 只设置latency时排序结果与只按平均延迟排序相同
+func (w weights) scores(stats []IPStat) []float64 {
+	metrics := []struct {
+		weight float64
+		value  func(IPStat) float64
+	}{
+		{w.Latency, func(s IPStat) float64 { return s.Avg }},
+		{w.Jitter, func(s IPStat) float64 { return s.Jitter }},
+		{w.Loss, func(s IPStat) float64 { return s.Loss }},
+	}
+
+	scores := make([]float64, len(stats))
+	for _, m := range metrics {
+		if m.weight == 0 || len(stats) == 0 {
+			continue
+		}
+		lo, hi := m.value(stats[0]), m.value(stats[0])
+		for _, s := range stats {
+			lo, hi = min(lo, m.value(s)), max(hi, m.value(s))
+		}
+		if hi == lo {
+			continue
+		}
+		for i, s := range stats {
+			scores[i] += m.weight * (m.value(s) - lo) / (hi - lo)
+		}
+	}
+	return scores
+}
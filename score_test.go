@@ -0,0 +1,86 @@
+package main
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+func TestParseScoreFormula(t *testing.T) {
+	tests := []struct {
+		formula string
+		want    weights
+		wantErr bool
+	}{
+		{formula: "latency=1", want: weights{Latency: 1}},
+		{formula: " latency=0.5, jitter=0.3 ,loss=0.2,", want: weights{Latency: 0.5, Jitter: 0.3, Loss: 0.2}},
+		{formula: "loss=1", want: weights{Loss: 1}},
+		{formula: "latency", wantErr: true},
+		{formula: "latency=abc", wantErr: true},
+		{formula: "latency=-1", wantErr: true},
+		{formula: "speed=1", wantErr: true},
+		{formula: "latency=0,jitter=0", wantErr: true},
+		{formula: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseScoreFormula(tt.formula)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseScoreFormula(%q) err = %v, wantErr %v", tt.formula, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got != tt.want {
+			t.Errorf("parseScoreFormula(%q) = %+v, want %+v", tt.formula, got, tt.want)
+		}
+	}
+}
+
+// 各指标按最小-最大值归一化到[0,1]后加权求和
+func TestWeightsScores(t *testing.T) {
+	stats := []IPStat{
+		{IP: "1.1.1.1", Avg: 10, Jitter: 8, Loss: 0},
+		{IP: "2.2.2.2", Avg: 30, Jitter: 0, Loss: 0.5},
+		{IP: "3.3.3.3", Avg: 20, Jitter: 4, Loss: 0.25},
+	}
+	tests := []struct {
+		name string
+		w    weights
+		want []float64
+	}{
+		{"只看延迟", weights{Latency: 1}, []float64{0, 1, 0.5}},
+		{"只看抖动", weights{Jitter: 2}, []float64{2, 0, 1}},
+		{"组合权重", weights{Latency: 0.5, Jitter: 0.3, Loss: 0.2}, []float64{0.3, 0.7, 0.5}},
+	}
+	for _, tt := range tests {
+		got := tt.w.scores(stats)
+		if !slices.EqualFunc(got, tt.want, func(a, b float64) bool { return math.Abs(a-b) < 1e-9 }) {
+			t.Errorf("%s: scores() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// 所有候选某项指标相同时该项记为0，不会除以0
+	same := []IPStat{{IP: "1.1.1.1", Avg: 10, Loss: 0.5}, {IP: "2.2.2.2", Avg: 10, Loss: 0.5}}
+	if got := (weights{Latency: 1, Loss: 1}).scores(same); !slices.Equal(got, []float64{0, 0}) {
+		t.Errorf("相同指标: scores() = %v, want [0 0]", got)
+	}
+	if got := (weights{Latency: 1}).scores(nil); len(got) != 0 {
+		t.Errorf("没有候选: scores() = %v", got)
+	}
+}
+
+// 设置权重后rankIPs按综合得分排序
+func TestRankIPsScoreFormula(t *testing.T) {
+	setFlag(t, &scoreWeights, weights{Latency: 1})
+	pings := []PingResult{
+		{Node: "北京电信", IP: "1.1.1.1", Time: 10},
+		{Node: "上海联通", IP: "1.1.1.1", Time: 50},
+		{Node: "北京电信", IP: "2.2.2.2", Time: 31},
+		{Node: "上海联通", IP: "2.2.2.2", Time: 31},
+	}
+	if got := rankIPs(pings)[0].IP; got != "1.1.1.1" {
+		t.Errorf("只看延迟时最优IP = %s, want 1.1.1.1", got)
+	}
+	scoreWeights = weights{Latency: 0.4, Jitter: 0.6}
+	if got := rankIPs(pings)[0].IP; got != "2.2.2.2" {
+		t.Errorf("考虑抖动时最优IP = %s, want 2.2.2.2", got)
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// 域名的主域名（最后两级），用于判断多个域名是否属于同一服务
+func baseDomain(domain string) string {
+	labels := strings.Split(strings.TrimSuffix(domain, "."), ".")
+	if len(labels) <= 2 {
+		return strings.Join(labels, ".")
+	}
+	return strings.Join(labels[len(labels)-2:], ".")
+}
+
+// 检查是否有IP被多个不相关的域名共用并给出警告，返回这样的IP个数。
+// 有些CDN确实会让不同服务共用IP，所以默认只警告。
+// 同一个 -shared-ip-domains 组内的域名视为相关
+func checkSharedIPs(results []Result, groups sharedGroups) int {
+	byIP := make(map[string][]string)
+	for _, r := range results {
+		if r.Error == "" {
+			byIP[r.IP] = append(byIP[r.IP], r.Domain)
+		}
+	}
+
+	conflicts := 0
+	for _, ip := range slices.Sorted(maps.Keys(byIP)) {
+		domains := byIP[ip]
+		bases := make(map[string]bool)
+		for _, d := range domains {
+			bases[groups.key(d)] = true
+		}
+		if len(bases) > 1 {
+			conflicts++
+			fmt.Fprintf(out, "⚠️ IP %s 同时被不相关的域名使用: %s\n", ip, strings.Join(domains, ", "))
+		}
+	}
+	return conflicts
+}
+
+// 需要共用同一个IP的域名组
+type sharedGroups [][]string
+
+// 解析 -shared-ip-domains
+func parseSharedGroups(s string) sharedGroups {
+	var groups sharedGroups
+	for g := range strings.SplitSeq(s, ";") {
+		var group []string
+		for d := range strings.SplitSeq(g, ",") {
+			if d = strings.TrimSpace(d); d != "" {
+				group = append(group, d)
+			}
+		}
+		if len(group) > 1 {
+			groups = append(groups, group)
+		}
+	}
+	return groups
+}
+
+// 域名是否属于某个共用组
+func (g sharedGroups) contains(domain string) bool {
+	for _, group := range g {
+		if slices.Contains(group, domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// 判断域名是否相关时使用的键：组内域名使用组的第一个域名，其余使用主域名
+func (g sharedGroups) key(domain string) string {
+	for _, group := range g {
+		if slices.Contains(group, domain) {
+			return "group:" + group[0]
+		}
+	}
+	return baseDomain(domain)
+}
+
+// 为组内域名选择共同的IP：在所有域名的候选中都出现的IP按各域名平均延迟的均值排序，
+// 取最低的一个；域名使用 -top 写入多个IP时取同样多个，各域名的 Top 保持一致。
+// 启用 -verify 时跳过无法连接的IP，保证写入的IP都经过验证。
+// 没有共同的IP时各域名保留各自的结果。返回组内探测成功的域名在results中的下标
+func assignSharedIP(ctx context.Context, results []Result, group []string) []int {
+	var idx []int
+	for i, r := range results {
+		if r.Error == "" && slices.Contains(group, r.Domain) {
+			idx = append(idx, i)
+		}
+	}
+	if len(idx) < 2 {
+		return idx
+	}
+
+	// 每个IP在各域名下的平均延迟之和及出现次数
+	sums := make(map[string]float64)
+	counts := make(map[string]int)
+	want := 1
+	for _, i := range idx {
+		for _, c := range results[i].Candidates {
+			sums[c.IP] += c.Avg
+			counts[c.IP]++
+		}
+		want = max(want, len(results[i].Top))
+	}
+	var common []string
+	for ip := range sums {
+		if counts[ip] == len(idx) {
+			common = append(common, ip)
+		}
+	}
+	score := func(ip string) float64 { return sums[ip] / float64(len(idx)) }
+	slices.SortFunc(common, func(a, b string) int {
+		if c := cmp.Compare(score(a), score(b)); c != 0 {
+			return c
+		}
+		return strings.Compare(a, b)
+	})
+
+	var domains []string
+	for _, i := range idx {
+		domains = append(domains, results[i].Domain)
+	}
+
+	var shared []string
+	for _, ip := range common {
+		if len(shared) == want {
+			break
+		}
+		if *verify && !reachable(ctx, ip) {
+			fmt.Fprintf(out, "⚠️ %s 的共同IP %s 无法连接，跳过\n", strings.Join(domains, ", "), ip)
+			continue
+		}
+		shared = append(shared, ip)
+	}
+	if len(shared) == 0 {
+		fmt.Fprintf(out, "⚠️ %s 没有共同的候选IP，分别使用各自最快的IP\n", strings.Join(domains, ", "))
+		return idx
+	}
+
+	fmt.Fprintf(out, "🔗 %s 共用IP %s (平均延迟 %s)\n", strings.Join(domains, ", "), strings.Join(shared, ", "), formatLatency(score(shared[0])))
+	for _, i := range idx {
+		r := &results[i]
+		r.IP, r.Top = shared[0], nil
+		if len(shared) > 1 {
+			r.Top = shared
+		}
+		for _, c := range r.Candidates {
+			if c.IP == r.IP {
+				r.Latency = c.Avg
+			}
+		}
+	}
+	return idx
+}
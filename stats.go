@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+)
+
+// 一轮运行的汇总统计，延迟按 -latency-unit 换算
+type Stats struct {
+	Min       float64 `json:"min"`
+	Median    float64 `json:"median"`
+	P90       float64 `json:"p90"`
+	Max       float64 `json:"max"`
+	Unit      string  `json:"latency_unit"`
+	Updated   int     `json:"updated"`
+	Unchanged int     `json:"unchanged"`
+	Failed    int     `json:"failed"`
+}
+
+// 根据各域名选中IP的延迟计算统计
+func computeStats(results []Result) *Stats {
+	s := &Stats{Unit: *latencyUnit}
+	var latencies []float64
+	for _, r := range results {
+		if r.Error != "" {
+			s.Failed++
+			continue
+		}
+		latencies = append(latencies, r.Latency)
+		switch r.Action {
+		case actionAdded, actionUpdated:
+			s.Updated++
+		case actionUnchanged:
+			s.Unchanged++
+		}
+	}
+
+	if len(latencies) == 0 {
+		return s
+	}
+	slices.Sort(latencies)
+	s.Min = latencyIn(latencies[0])
+	s.Median = latencyIn(percentile(latencies, 50))
+	s.P90 = latencyIn(percentile(latencies, 90))
+	s.Max = latencyIn(latencies[len(latencies)-1])
+	return s
+}
+
+// 已排序数据的百分位数（线性插值）
+func percentile(sorted []float64, p float64) float64 {
+	pos := p / 100 * float64(len(sorted)-1)
+	lo := int(pos)
+	if lo+1 >= len(sorted) {
+		return sorted[lo]
+	}
+	return sorted[lo] + (pos-float64(lo))*(sorted[lo+1]-sorted[lo])
+}
+
+// 打印统计
+func printStats(s *Stats) {
+	unit := s.Unit
+	fmt.Fprintln(out, "\n📊 统计：")
+	fmt.Fprintf(out, "  延迟 最小 %.2f%s / 中位数 %.2f%s / P90 %.2f%s / 最大 %.2f%s\n",
+		s.Min, unit, s.Median, unit, s.P90, unit, s.Max, unit)
+	fmt.Fprintf(out, "  更新 %d 个，无需更新 %d 个，失败 %d 个\n", s.Updated, s.Unchanged, s.Failed)
+}
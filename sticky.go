@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// 上次选择的结果，-sticky-window 大于0时在每轮开始时从缓存读取
+var stickyCache map[string]cacheEntry
+
+// 避免两个延迟相近的IP在多次运行间来回切换：上次选择的IP在 -sticky-window 内
+// 继续使用，除非新的IP比它快 -sticky-margin 以上。上次的IP不在本次候选中时不保留
+func applySticky(r *Result) {
+	prev, ok := stickyCache[cacheKey(r.Domain)]
+	if !ok || prev.IP == r.IP || prev.ChosenAt.IsZero() || time.Since(prev.ChosenAt) >= *stickyWindow {
+		return
+	}
+	i := slices.IndexFunc(r.Candidates, func(c IPStat) bool { return c.IP == prev.IP })
+	if i < 0 {
+		return
+	}
+	old := r.Candidates[i]
+	if old.Avg-r.Latency > *stickyMargin {
+		fmt.Fprintf(out, "🔀 %s: %s 比上次的 %s 快 %s，切换\n", r.Domain, r.IP, prev.IP, formatLatency(old.Avg-r.Latency))
+		return
+	}
+
+	fmt.Fprintf(out, "📌 %s: 保持 %s 选择的 %s (%s)，新的 %s 快不到 %s\n", r.Domain, formatAge(time.Since(prev.ChosenAt))+"前",
+		prev.IP, formatLatency(old.Avg), r.IP, formatLatency(*stickyMargin))
+	r.IP, r.Latency = old.IP, old.Avg
+	if len(r.Top) > 0 {
+		// 保持的IP放到第一位，总数不变
+		top := slices.DeleteFunc(slices.Clone(r.Top), func(ip string) bool { return ip == old.IP })
+		r.Top = append([]string{old.IP}, top[:min(len(top), len(r.Top)-1)]...)
+	}
+}
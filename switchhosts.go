@@ -0,0 +1,71 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// SwitchHosts v4 的备份/导入格式（设置 > 导入），只包含一个本地方案。
+// 格式参照 SwitchHosts 4.x 导出的文件，version 字段为导出它的版本号
+type switchHostsExport struct {
+	Version []int `json:"version"`
+	Data    struct {
+		List struct {
+			Tree     []switchHostsItem `json:"tree"`
+			Trashcan []any             `json:"trashcan"`
+		} `json:"list"`
+		Collection struct {
+			Hosts struct {
+				Data []switchHostsContent `json:"data"`
+			} `json:"hosts"`
+		} `json:"collection"`
+	} `json:"data"`
+}
+
+// 方案列表中的一项
+type switchHostsItem struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+	Type  string `json:"type"`
+	On    bool   `json:"on"`
+}
+
+// 方案的hosts内容
+type switchHostsContent struct {
+	ID      string `json:"id"`
+	Content string `json:"content"`
+}
+
+// 目标SwitchHosts版本
+var switchHostsVersion = []int{4, 2, 0, 6250}
+
+// 生成SwitchHosts导入JSON，内容为管理区块
+func switchHostsJSON(ipMap map[string][]string) ([]byte, error) {
+	// 同名方案使用固定的ID，重复导入时覆盖而不是新增
+	sum := sha1.Sum([]byte("fastip:" + *sectionName))
+	id := hex.EncodeToString(sum[:8])
+
+	var e switchHostsExport
+	e.Version = switchHostsVersion
+	e.Data.List.Tree = []switchHostsItem{{ID: id, Title: *sectionName, Type: "local", On: true}}
+	e.Data.List.Trashcan = []any{}
+	e.Data.Collection.Hosts.Data = []switchHostsContent{{
+		ID:      id,
+		Content: strings.Join(renderBlock(ipMap), "\n") + "\n",
+	}}
+
+	data, err := marshalJSON(e)
+	if err != nil {
+		return nil, err
+	}
+
+	// 输出前确认生成的JSON可以被完整解析回来
+	var check switchHostsExport
+	if err := json.Unmarshal(data, &check); err != nil || len(check.Data.Collection.Hosts.Data) != 1 {
+		return nil, errors.New("生成的SwitchHosts JSON无效")
+	}
+	return data, nil
+}
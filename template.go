@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"text/template"
+)
+
+// -template 解析后的模板，为nil时使用默认的输出
+var resultTemplate *template.Template
+
+// 模板可用的字段
+type templateData struct {
+	Domain  string
+	IP      string   // 选出的IP，失败时为空
+	IPs     []string // 解析到的全部IP
+	Top     []string // 写入hosts的全部IP
+	AvgMs   float64  // 平均延迟(ms)
+	Latency string   // 按 -latency-unit 格式化的延迟
+	Action  string   // hosts条目的变化
+	Error   string
+}
+
+func parseResultTemplate(text string) error {
+	t, err := template.New("result").Parse(text)
+	if err != nil {
+		return err
+	}
+	resultTemplate = t
+	return nil
+}
+
+// 按模板输出一个结果，模板结尾没有换行时自动补上
+func renderResult(r Result) error {
+	var buf bytes.Buffer
+	err := resultTemplate.Execute(&buf, templateData{
+		Domain:  r.Domain,
+		IP:      r.IP,
+		IPs:     r.IPs,
+		Top:     r.hostIPs(),
+		AvgMs:   r.Latency,
+		Latency: formatLatency(r.Latency),
+		Action:  r.Action,
+		Error:   r.Error,
+	})
+	if err != nil {
+		return err
+	}
+	if !bytes.HasSuffix(buf.Bytes(), []byte("\n")) {
+		buf.WriteByte('\n')
+	}
+	printMu.Lock()
+	defer printMu.Unlock()
+	_, err = out.Write(buf.Bytes())
+	return err
+}
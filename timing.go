@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// 一次运行中耗时统计的阶段
+type phase int
+
+const (
+	phaseResolve phase = iota // 读取域名列表和CNAME解析
+	phaseQuery                // 向数据来源查询，各域名累计
+	phaseVerify               // 本机验证（-verify、-estimate、-write-if-faster），各域名累计
+	phaseProbe                // 并发探测全部域名的实际耗时
+	phaseWrite                // 写入hosts
+	phaseFlush                // 刷新DNS缓存
+	numPhases
+)
+
+// 各阶段的耗时，用于 -timing
+type phaseTimer struct {
+	mu sync.Mutex
+	d  [numPhases]time.Duration
+}
+
+// 本轮运行的耗时统计，每轮开始时重置
+var timer = new(phaseTimer)
+
+// 把从start到现在的时间计入阶段p，可在并发的探测中调用
+func (t *phaseTimer) since(p phase, start time.Time) {
+	d := time.Since(start)
+	t.mu.Lock()
+	t.d[p] += d
+	t.mu.Unlock()
+}
+
+// -timing 输出的各阶段耗时(ms)。查询和本机验证是各域名的累计值，
+// 并发时会大于探测阶段的实际耗时，两者之比大致反映了并发的收益
+type Timing struct {
+	Resolve float64 `json:"resolve_ms"`
+	Query   float64 `json:"query_ms"`
+	Verify  float64 `json:"verify_ms"`
+	Probe   float64 `json:"probe_ms"`
+	Write   float64 `json:"hosts_write_ms"`
+	Flush   float64 `json:"flush_ms"`
+	Total   float64 `json:"total_ms"`
+}
+
+func (t *phaseTimer) report(total time.Duration) *Timing {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ms := func(d time.Duration) float64 { return float64(d.Microseconds()) / 1000 }
+	return &Timing{
+		Resolve: ms(t.d[phaseResolve]),
+		Query:   ms(t.d[phaseQuery]),
+		Verify:  ms(t.d[phaseVerify]),
+		Probe:   ms(t.d[phaseProbe]),
+		Write:   ms(t.d[phaseWrite]),
+		Flush:   ms(t.d[phaseFlush]),
+		Total:   ms(total),
+	}
+}
+
+func printTiming(t *Timing) {
+	fmt.Fprintln(out, "\n⏱️ 耗时：")
+	for _, p := range []struct {
+		name string
+		ms   float64
+		note string
+	}{
+		{"读取域名", t.Resolve, ""},
+		{"数据来源查询", t.Query, " (各域名累计)"},
+		{"本机验证", t.Verify, " (各域名累计)"},
+		{"探测", t.Probe, ""},
+		{"写入hosts", t.Write, ""},
+		{"刷新DNS", t.Flush, ""},
+		{"总计", t.Total, ""},
+	} {
+		fmt.Fprintf(out, "  %10.1fms  %s%s\n", p.ms, p.name, p.note)
+	}
+}
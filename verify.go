@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var ErrUnreachable = errors.New("候选IP均无法连接")
+
+// -probe-ports 解析后的端口列表
+var probePortList = []string{"443"}
+
+// 解析逗号分隔的端口列表，如 80,443
+func parsePorts(s string) ([]string, error) {
+	var ports []string
+	for p := range strings.SplitSeq(s, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		if n, err := strconv.Atoi(p); err != nil || n < 1 || n > 65535 {
+			return nil, fmt.Errorf("无效的端口 %q", p)
+		}
+		if !slices.Contains(ports, p) {
+			ports = append(ports, p)
+		}
+	}
+	if len(ports) == 0 {
+		return nil, errors.New("端口列表为空")
+	}
+	return ports, nil
+}
+
+// 检查能否在超时内与ip的 -probe-ports 中每个端口建立TCP连接，
+// 任一端口失败即视为不可用，并报告各端口的结果
+func reachable(ctx context.Context, ip string) bool {
+	ok := true
+	var report []string
+	for _, port := range probePortList {
+		if dialPort(ctx, ip, port).Timeout {
+			ok = false
+			report = append(report, port+" ❌")
+		} else {
+			report = append(report, port+" ✅")
+		}
+	}
+	if len(probePortList) > 1 {
+		if ok {
+			verbosef("%s 端口: %s\n", ip, strings.Join(report, " "))
+		} else {
+			fmt.Fprintf(out, "🔌 %s 端口: %s\n", ip, strings.Join(report, " "))
+		}
+	}
+	return ok
+}
+
+// 检查要写入的IP能否连接，把无法连接的IP换成下一个可连接的候选IP，
+// 没有任何可连接的IP时把结果标记为失败
+func verifyResult(ctx context.Context, r *Result) {
+	want := r.hostIPs()
+	checked := make(map[string]bool)
+	ok := func(ip string) bool {
+		v, seen := checked[ip]
+		if !seen {
+			v = reachable(ctx, ip)
+			checked[ip] = v
+		}
+		return v
+	}
+
+	next := 0
+	var ips []string
+	for _, ip := range want {
+		if ok(ip) {
+			ips = append(ips, ip)
+			continue
+		}
+
+		// 按延迟顺序找下一个可连接且未被使用的候选IP
+		sub := ""
+		for ; next < len(r.Candidates); next++ {
+			c := r.Candidates[next].IP
+			if !slices.Contains(want, c) && !slices.Contains(ips, c) && ok(c) {
+				sub = c
+				next++
+				break
+			}
+		}
+		if sub == "" {
+			fmt.Fprintf(out, "⚠️ %s: %s 无法连接，没有可替代的候选IP\n", r.Domain, ip)
+			continue
+		}
+		fmt.Fprintf(out, "🔁 %s: %s 无法连接，改用 %s\n", r.Domain, ip, sub)
+		ips = append(ips, sub)
+	}
+
+	if len(ips) == 0 {
+		fmt.Fprintf(out, "⏭️ 跳过 %s: 候选IP均无法连接\n", r.Domain)
+		r.Error = ErrUnreachable.Error()
+		return
+	}
+
+	r.IP = ips[0]
+	for _, c := range r.Candidates {
+		if c.IP == r.IP {
+			r.Latency = c.Avg
+		}
+	}
+	if len(r.Top) > 0 {
+		r.Top = ips
+	}
+}
+
+// 是否有任一IP可以连接，找到一个即返回
+func anyReachable(ctx context.Context, ipMap map[string][]string) bool {
+	for _, domain := range slices.Sorted(maps.Keys(ipMap)) {
+		for _, ip := range ipMap[domain] {
+			if reachable(ctx, ip) {
+				verbosef("%s (%s) 可以连接\n", ip, domain)
+				return true
+			}
+		}
+	}
+	return false
+}
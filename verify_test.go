@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestParsePorts(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    []string
+		wantErr bool
+	}{
+		{s: "443", want: []string{"443"}},
+		{s: " 80, 443,80,", want: []string{"80", "443"}},
+		{s: "0", wantErr: true},
+		{s: "65536", wantErr: true},
+		{s: "http", wantErr: true},
+		{s: " , ", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parsePorts(tt.s)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parsePorts(%q) err = %v, wantErr %v", tt.s, err, tt.wantErr)
+			continue
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("parsePorts(%q) = %v, want %v", tt.s, got, tt.want)
+		}
+	}
+}
+
+// 本机只在一个端口上监听，另一个端口无法连接
+func listenOnePort(t *testing.T) (open, closed string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("无法监听本地端口: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	// 取一个刚释放的端口作为未监听的端口
+	tmp, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("无法监听本地端口: %v", err)
+	}
+	_, closed, _ = net.SplitHostPort(tmp.Addr().String())
+	tmp.Close()
+	_, open, _ = net.SplitHostPort(ln.Addr().String())
+
+	if conn, err := net.DialTimeout("tcp", net.JoinHostPort("127.0.0.1", closed), time.Second); err == nil {
+		conn.Close()
+		t.Skip("当前环境中未监听的端口也能连接")
+	}
+	return open, closed
+}
+
+func TestDialPort(t *testing.T) {
+	open, closed := listenOnePort(t)
+	setFlag(t, probeTimeout, time.Second)
+
+	p := dialPort(context.Background(), "127.0.0.1", open)
+	if p.Timeout || p.IP != "127.0.0.1" || p.Node != "本机" || p.Time < 0 {
+		t.Errorf("dialPort(监听的端口) = %+v", p)
+	}
+	if p := dialPort(context.Background(), "127.0.0.1", closed); !p.Timeout {
+		t.Errorf("dialPort(未监听的端口) = %+v, want 超时", p)
+	}
+}
+
+// -probe-ports 中任一端口无法连接即视为不可用
+func TestReachableProbePorts(t *testing.T) {
+	open, closed := listenOnePort(t)
+	setFlag(t, probeTimeout, time.Second)
+	setFlag(t, &out, io.Discard)
+
+	tests := []struct {
+		ports []string
+		want  bool
+	}{
+		{[]string{open}, true},
+		{[]string{closed}, false},
+		{[]string{open, closed}, false},
+		{[]string{closed, open}, false},
+	}
+	for _, tt := range tests {
+		setFlag(t, &probePortList, tt.ports)
+		if got := reachable(context.Background(), "127.0.0.1"); got != tt.want {
+			t.Errorf("reachable(%v) = %v, want %v", tt.ports, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// 构建信息，构建时通过 -ldflags 注入，例如
+//
+//	go build -ldflags "-X main.version=v1.2.0 -X main.commit=$(git rev-parse --short HEAD) -X main.buildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// 版本号会写入管理区块的起始标记，便于判断条目的生成时间和来源
+var (
+	version   = "dev"
+	commit    = ""
+	buildDate = ""
+)
+
+type buildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildDate string `json:"build_date,omitempty"`
+	GoVersion string `json:"go_version"`
+	Platform  string `json:"platform"`
+}
+
+// 当前程序的构建信息，未注入提交和时间时使用Go记录的版本控制信息
+func currentBuildInfo() buildInfo {
+	info := buildInfo{
+		Version:   version,
+		Commit:    commit,
+		BuildDate: buildDate,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range bi.Settings {
+			switch {
+			case s.Key == "vcs.revision" && info.Commit == "":
+				info.Commit = s.Value
+			case s.Key == "vcs.time" && info.BuildDate == "":
+				info.BuildDate = s.Value
+			}
+		}
+	}
+	return info
+}
+
+// -version 的输出，-format json 时输出JSON
+func printVersion() error {
+	info := currentBuildInfo()
+	if *format == "json" || *jsonOut || *jsonPretty {
+		data, err := marshalJSON(info)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	fmt.Printf("fastip %s\n", info.Version)
+	if info.Commit != "" {
+		fmt.Printf("提交: %s\n", info.Commit)
+	}
+	if info.BuildDate != "" {
+		fmt.Printf("构建时间: %s\n", info.BuildDate)
+	}
+	fmt.Printf("Go: %s %s\n", info.GoVersion, info.Platform)
+	return nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"time"
+)
+
+// 每次运行使用独立播种的随机源，避免多台机器按相同的cron同时启动时
+// 产生相同的抖动序列
+var rng = rand.New(rand.NewPCG(uint64(time.Now().UnixNano()), uint64(os.Getpid())))
+
+// 返回 [0, -jitter) 内的随机等待时间
+func jitterDelay() time.Duration {
+	if *jitter <= 0 {
+		return 0
+	}
+	return time.Duration(rng.Int64N(int64(*jitter)))
+}
+
+// 监视模式：按 -watch 间隔循环运行。每次间隔在固定的 -watch 基础上叠加
+// 随机抖动，使大量机器的请求分散开，减轻itdog的压力和被限流的可能。
+// 指定 -on-network-change 时，网络变化后不等间隔结束立即重新运行
+func watchLoop(ctx context.Context, provider LatencyProvider) {
+	if *jitterStartup {
+		if d := jitterDelay(); d > 0 {
+			fmt.Fprintf(out, "⏳ 随机等待 %s 后开始\n", d.Round(time.Second))
+			time.Sleep(d)
+		}
+	}
+
+	var netChanged <-chan struct{}
+	if *onNetworkChange {
+		netChanged = watchNetwork(ctx)
+	}
+
+	for {
+		if err := run(ctx, provider); err != nil {
+			fmt.Fprintf(out, "⚠️ 本轮运行失败: %v\n", err)
+		}
+		// 只有第一轮需要从状态文件续跑
+		*resume = false
+
+		d := *watch + jitterDelay()
+		fmt.Fprintf(out, "⏳ %s 后再次运行\n", d.Round(time.Second))
+		select {
+		case <-time.After(d):
+		case <-netChanged:
+			fmt.Fprintln(out, "🔀 检测到网络变化，立即重新探测")
+		}
+	}
+}
+
+var (
+	lastFlush    time.Time // 监视模式下上次刷新DNS的时间
+	flushPending bool      // 是否有因冷却推迟的刷新
+)
+
+// 监视模式下两次刷新DNS至少间隔 -flush-cooldown，避免频繁清空其他程序的缓存；
+// 冷却期内的刷新推迟到之后的某一轮
+func flushWithCooldown() {
+	if *watch > 0 && !lastFlush.IsZero() && time.Since(lastFlush) < *flushCooldown {
+		flushPending = true
+		fmt.Fprintf(out, "⏳ 距上次刷新DNS不足 %s，推迟刷新\n", *flushCooldown)
+		return
+	}
+	flushPending = false
+	lastFlush = time.Now()
+	flushDNS()
+	timer.since(phaseFlush, lastFlush)
+}